@@ -0,0 +1,77 @@
+package rawterm
+
+import "unicode"
+
+// AddAbbrev makes abbr expand to expansion when it's typed as the first
+// word of a command followed by a space or Enter, like fish abbreviations.
+// A Backspace right after the expansion undoes it, the following key
+// doesn't expand it again.
+func (c *Config) AddAbbrev(abbr, expansion string) {
+	if c.Abbreviations == nil {
+		c.Abbreviations = make(map[string]string)
+	}
+	c.Abbreviations[abbr] = expansion
+}
+
+// the line before an abbreviation was expanded
+type abbrevUndo struct {
+	line []rune
+	pos  int
+}
+
+// expandAbbrev expands the abbreviation before the cursor, if there's one.
+// If space is true it's about to be inserted, a space ending the
+// expansion takes its place. It reports whether space was handled.
+func (o *Operation) expandAbbrev(space bool) bool {
+	if len(o.cfg.Abbreviations) == 0 || o.skipAbbrev {
+		return false
+	}
+	o.flushBurst()
+	line, pos := o.buf.Runes(), o.buf.Pos()
+	start := pos
+	for start > 0 && !unicode.IsSpace(line[start-1]) {
+		start--
+	}
+	if start == pos || !isCommandStart(line[:start]) {
+		return false
+	}
+	exp, ok := o.cfg.Abbreviations[string(line[start:pos])]
+	if !ok {
+		return false
+	}
+
+	if space {
+		// Enter ends the line, there's nothing left to undo
+		o.abbrevUndo = &abbrevUndo{line, pos}
+	}
+	rs := []rune(exp)
+	if space && (len(rs) == 0 || rs[len(rs)-1] != ' ') {
+		rs = append(rs, ' ')
+	}
+	newLine := append(append(append([]rune(nil), line[:start]...), rs...), line[pos:]...)
+	o.setLine(start+len(rs), newLine)
+	return space
+}
+
+// isCommandStart reports whether a word after head is in command position,
+// at the start of the line or after ; | & or (.
+func isCommandStart(head []rune) bool {
+	for i := len(head) - 1; i >= 0; i-- {
+		switch c := head[i]; {
+		case unicode.IsSpace(c):
+		case c == ';' || c == '|' || c == '&' || c == '(':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AddAbbrev adds an abbreviation while the operation is running, see
+// Config.AddAbbrev.
+func (o *Operation) AddAbbrev(abbr, expansion string) {
+	o.m.Lock()
+	o.cfg.AddAbbrev(abbr, expansion)
+	o.m.Unlock()
+}
@@ -0,0 +1,47 @@
+package rawterm
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestAbbreviations(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, _ := newTestInstance(t, r)
+	rl.AddAbbrev("g", "git ")
+	rl.AddAbbrev("st", "status")
+
+	// typed one key at a time, the second g expansion is undone and the
+	// last g is not a command
+	go func() {
+		for _, k := range []string{"g", " ", "st", " ", "x", ";", "g", " ", "\x7f", " ", "g", "\r"} {
+			w.Write([]byte(k))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	line, err := rl.Readline()
+	if err != nil || line != "git st x;g g" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	// an expansion on Enter can't be undone on the next line
+	for _, tc := range []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"g", "\r"}, "git "},
+		{[]string{"\x7f", "x", "\r"}, "x"},
+	} {
+		go func(keys []string) {
+			for _, k := range keys {
+				w.Write([]byte(k))
+				time.Sleep(time.Millisecond)
+			}
+		}(tc.keys)
+		if line, err := rl.Readline(); err != nil || line != tc.expect {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package rawterm
+
+import (
+	"io"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// NewANSIConsoleWriter returns a writer for f which handles ANSI escape
+// sequences the way the terminal behind it needs:
+//
+// 	- f is not a terminal: sequences are stripped, see NewANSIStripWriter
+// 	- legacy windows console: sequences are translated to console API calls
+// 	- everything else: sequences are passed through unchanged
+func NewANSIConsoleWriter(f *os.File) io.Writer {
+	if !IsTerminal(int(f.Fd())) {
+		return NewANSIStripWriter(f)
+	}
+	return newConsoleWriter(f)
+}
+
+// ANSIStripWriter removes ANSI escape sequences (CSI, OSC, DCS and two byte
+// escapes) from everything written to it. Sequences and runes may be split
+// across writes.
+type ANSIStripWriter struct {
+	target io.Writer
+	parser ansiParser
+	out    []byte
+	// the start of a rune split between writes
+	partial []byte
+	sync.Mutex
+}
+
+func NewANSIStripWriter(w io.Writer) *ANSIStripWriter {
+	a := &ANSIStripWriter{target: w}
+	keep := func(r rune) {
+		a.out = append(a.out, string(r)...)
+	}
+	a.parser.print = keep
+	a.parser.execute = keep
+	return a
+}
+
+func (a *ANSIStripWriter) Write(b []byte) (int, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.out = a.out[:0]
+	p := append(a.partial, b...)
+	for len(p) > 0 && utf8.FullRune(p) {
+		r, size := utf8.DecodeRune(p)
+		a.parser.feed(r)
+		p = p[size:]
+	}
+	a.partial = append(a.partial[:0], p...)
+	if _, err := a.target.Write(a.out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+type ansiState int
+
+const (
+	ansiGround ansiState = iota
+	ansiEscape
+	ansiEscapeInter
+	ansiCSIParam
+	ansiCSIInter
+	ansiCSIIgnore
+	ansiOSC
+	ansiDCS
+	ansiIgnoreString // SOS, PM and APC
+)
+
+// ansiParser splits a stream into text, control characters and escape
+// sequences with the state machine of VT500 terminals, see
+// https://vt100.net/emu/dec_ansi_parser. It's fed one rune at a time, so a
+// sequence may be split anywhere, and it always knows where a sequence it
+// doesn't understand ends. Both keys and output for consoles without ANSI
+// support are decoded with it.
+type ansiParser struct {
+	state ansiState
+	// the parameters with the private marker, e.g. "?25", the intermediate
+	// bytes and the content of OSC and DCS strings
+	params []rune
+	inter  []rune
+	data   []rune
+
+	// any of these may be nil
+	print   func(r rune)
+	execute func(c rune)
+	esc     func(inter []rune, final rune)
+	csi     func(params, inter []rune, final rune)
+	osc     func(data []rune)
+	dcs     func(data []rune)
+}
+
+// feed handles r and reports whether the parser is back on plain text
+// afterwards, i.e. no sequence is started or unfinished.
+func (p *ansiParser) feed(r rune) bool {
+	switch {
+	case r == 0x18 || r == 0x1a: // CAN and SUB abort a sequence
+		p.state = ansiGround
+		p.exec(r)
+		return true
+	case r == CharEsc:
+		p.endString()
+		p.params, p.inter, p.data = p.params[:0], p.inter[:0], p.data[:0]
+		p.state = ansiEscape
+		return false
+	}
+
+	switch p.state {
+	case ansiGround:
+		if r < 0x20 {
+			p.exec(r)
+		} else if p.print != nil {
+			p.print(r)
+		}
+	case ansiEscape, ansiEscapeInter:
+		switch {
+		case r < 0x20:
+			p.exec(r)
+		case r <= 0x2f:
+			p.inter = append(p.inter, r)
+			p.state = ansiEscapeInter
+		case p.state == ansiEscapeInter:
+			p.dispatchEsc(r)
+		case r == '[':
+			p.state = ansiCSIParam
+		case r == ']':
+			p.state = ansiOSC
+		case r == 'P':
+			p.state = ansiDCS
+		case r == 'X' || r == '^' || r == '_':
+			p.state = ansiIgnoreString
+		default:
+			p.dispatchEsc(r)
+		}
+	case ansiCSIParam, ansiCSIInter, ansiCSIIgnore:
+		switch {
+		case r < 0x20:
+			p.exec(r)
+		case r <= 0x2f:
+			p.inter = append(p.inter, r)
+			if p.state == ansiCSIParam {
+				p.state = ansiCSIInter
+			}
+		case r <= 0x3f:
+			p.params = append(p.params, r)
+			if p.state == ansiCSIInter {
+				p.state = ansiCSIIgnore
+			}
+		case r <= 0x7e:
+			if p.state != ansiCSIIgnore && p.csi != nil {
+				p.csi(p.params, p.inter, r)
+			}
+			p.state = ansiGround
+		default:
+			p.state = ansiCSIIgnore
+		}
+	case ansiOSC, ansiDCS, ansiIgnoreString:
+		// terminated by ST, ESC \, but BEL is common too
+		switch {
+		case r == CharBell:
+			p.endString()
+			p.state = ansiGround
+		case r >= 0x20:
+			p.data = append(p.data, r)
+		}
+	}
+	return p.state == ansiGround
+}
+
+func (p *ansiParser) exec(c rune) {
+	if p.execute != nil {
+		p.execute(c)
+	}
+}
+
+func (p *ansiParser) dispatchEsc(final rune) {
+	// ESC \ ends a string, which endString already took care of
+	if p.esc != nil && !(final == '\\' && len(p.inter) == 0) {
+		p.esc(p.inter, final)
+	}
+	p.state = ansiGround
+}
+
+// endString dispatches the OSC or DCS string being read, if any.
+func (p *ansiParser) endString() {
+	switch p.state {
+	case ansiOSC:
+		if p.osc != nil {
+			p.osc(p.data)
+		}
+	case ansiDCS:
+		if p.dcs != nil {
+			p.dcs(p.data)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package rawterm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestANSIStripWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewANSIStripWriter(buf)
+	w.Write([]byte("\033[1;31mred\033[0m \033]0;title\007ok\033"))
+	w.Write([]byte("[K!"))
+	if buf.String() != "red ok!" {
+		t.Fatalf("result not expect: %q", buf.String())
+	}
+
+	// a rune split between writes
+	buf.Reset()
+	w.Write([]byte("\033[1m世"[:6]))
+	w.Write([]byte("世界\033[0m"[2:]))
+	if buf.String() != "世界" {
+		t.Fatalf("result not expect: %q", buf.String())
+	}
+}
+
+func TestANSIParser(t *testing.T) {
+	var got []string
+	p := ansiParser{
+		print: func(r rune) { got = append(got, string(r)) },
+		csi: func(params, inter []rune, final rune) {
+			got = append(got, "csi "+string(params)+string(inter)+string(final))
+		},
+		esc: func(inter []rune, final rune) { got = append(got, "esc "+string(final)) },
+		osc: func(data []rune) { got = append(got, "osc "+string(data)) },
+	}
+	// split in the middle of every sequence
+	for _, s := range []string{"a\033[?2", "5h\0337\033]0;ti", "tle\033", "\\\033[1 qb"} {
+		for _, r := range s {
+			p.feed(r)
+		}
+	}
+	want := "a|csi ?25h|esc 7|osc 0;title|csi 1 q|b"
+	if s := strings.Join(got, "|"); s != want {
+		t.Fatalf("result not expect: %q", s)
+	}
+}
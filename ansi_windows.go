@@ -49,6 +49,9 @@ var ColorTableBg = []word{
 	COLOR_BRED | COLOR_BBLUE | COLOR_BGREEN, // 47: White
 }
 
+// ANSIWriter translates ANSI escape sequences written to it into console API
+// calls, for consoles without VT support. The calls always act on the
+// console of the process stdout, whatever the target writer is.
 type ANSIWriter struct {
 	target io.Writer
 	wg     sync.WaitGroup
@@ -70,17 +73,21 @@ func (a *ANSIWriter) Close() error {
 }
 
 type ANSIWriterCtx struct {
-	isEsc     bool
-	isEscSeq  bool
-	arg       []string
-	target    *bufio.Writer
-	wantFlush bool
+	parser ansiParser
+	target *bufio.Writer
+	// the cursor position saved by ESC 7
+	saved *_COORD
 }
 
 func NewANSIWriterCtx(target io.Writer) *ANSIWriterCtx {
-	return &ANSIWriterCtx{
+	a := &ANSIWriterCtx{
 		target: bufio.NewWriter(target),
 	}
+	a.parser.print = func(r rune) { a.target.WriteRune(r) }
+	a.parser.execute = func(c rune) { a.target.WriteRune(c) }
+	a.parser.esc = a.esc
+	a.parser.csi = a.csi
+	return a
 }
 
 func (a *ANSIWriterCtx) Flush() {
@@ -88,46 +95,43 @@ func (a *ANSIWriterCtx) Flush() {
 }
 
 func (a *ANSIWriterCtx) process(r rune) bool {
-	if a.wantFlush {
-		if r == 0 || r == CharEsc {
-			a.wantFlush = false
-			a.target.Flush()
-		}
-	}
-	if a.isEscSeq {
-		a.isEscSeq = a.ioloopEscSeq(a.target, r, &a.arg)
-		return true
-	}
+	a.parser.feed(r)
+	return true
+}
 
-	switch r {
-	case CharEsc:
-		a.isEsc = true
-	case '[':
-		if a.isEsc {
-			a.arg = nil
-			a.isEscSeq = true
-			a.isEsc = false
-			break
+func (a *ANSIWriterCtx) esc(inter []rune, final rune) {
+	if len(inter) > 0 {
+		return
+	}
+	a.target.Flush()
+	switch final {
+	case '7':
+		if info, err := GetConsoleScreenBufferInfo(); err == nil {
+			pos := info.dwCursorPosition
+			a.saved = &pos
+		}
+	case '8':
+		if a.saved != nil {
+			SetConsoleCursorPosition(a.saved)
 		}
-		fallthrough
-	default:
-		a.target.WriteRune(r)
-		a.wantFlush = true
 	}
-	return true
 }
 
-func (a *ANSIWriterCtx) ioloopEscSeq(w *bufio.Writer, r rune, argptr *[]string) bool {
-	arg := *argptr
-	var err error
+func (a *ANSIWriterCtx) csi(params, inter []rune, final rune) {
+	// the text before the sequence has to be on the screen first
+	a.target.Flush()
+	if len(inter) > 0 {
+		return
+	}
+	arg := strings.Split(string(params), ";")
 
-	if r >= 'A' && r <= 'D' {
+	if final >= 'A' && final <= 'D' {
 		count := short(GetInt(arg, 1))
 		info, err := GetConsoleScreenBufferInfo()
 		if err != nil {
-			return false
+			return
 		}
-		switch r {
+		switch final {
 		case 'A': // up
 			info.dwCursorPosition.y -= count
 		case 'B': // down
@@ -138,22 +142,26 @@ func (a *ANSIWriterCtx) ioloopEscSeq(w *bufio.Writer, r rune, argptr *[]string)
 			info.dwCursorPosition.x -= count
 		}
 		SetConsoleCursorPosition(&info.dwCursorPosition)
-		return false
+		return
 	}
 
-	switch r {
+	switch final {
 	case 'J':
 		killLines()
 	case 'K':
 		eraseLine()
 	case 'm':
+		if strings.HasPrefix(arg[0], ">") {
+			break // modifyOtherKeys, not supported by the console
+		}
 		color := word(0)
 		for _, item := range arg {
-			var c int
-			c, err = strconv.Atoi(item)
+			if item == "" {
+				item = "0"
+			}
+			c, err := strconv.Atoi(item)
 			if err != nil {
-				w.WriteString("[" + strings.Join(arg, ";") + "m")
-				break
+				return
 			}
 			if c >= 30 && c < 40 {
 				color ^= COLOR_FINTENSITY
@@ -167,27 +175,13 @@ func (a *ANSIWriterCtx) ioloopEscSeq(w *bufio.Writer, r rune, argptr *[]string)
 				color = ColorTableFg[7]
 			}
 		}
-		if err != nil {
-			break
-		}
 		kernel.SetConsoleTextAttribute(stdout, uintptr(color))
-	case '\007': // set title
-	case ';':
-		if len(arg) == 0 || arg[len(arg)-1] != "" {
-			arg = append(arg, "")
-			*argptr = arg
-		}
-		return true
-	default:
-		if len(arg) == 0 {
-			arg = append(arg, "")
+	case 'h', 'l':
+		if len(arg) == 1 && arg[0] == "?25" {
+			SetConsoleCursorVisible(final == 'h')
 		}
-		arg[len(arg)-1] += string(r)
-		*argptr = arg
-		return true
 	}
-	*argptr = nil
-	return false
+	// anything else, like kitty keyboard flags (u), isn't supported
 }
 
 func (a *ANSIWriter) Write(b []byte) (int, error) {
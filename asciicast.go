@@ -0,0 +1,84 @@
+package rawterm
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// AsciicastWriter records terminal output as an asciicast v2 file, which
+// can be played back with asciinema. Each Write becomes one output event
+// timed from the creation of the writer.
+type AsciicastWriter struct {
+	m       sync.Mutex
+	w       io.Writer
+	start   time.Time
+	pending []byte // the start of a rune split across writes
+}
+
+type asciicastHeader struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// NewAsciicastWriter writes the asciicast header for a terminal of the
+// given size to w.
+func NewAsciicastWriter(w io.Writer, width, height int) (*AsciicastWriter, error) {
+	a := &AsciicastWriter{w: w, start: time.Now()}
+	header, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: a.start.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(header, '\n')); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AsciicastWriter) Write(b []byte) (int, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	data := append(a.pending, b...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	a.pending = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(b), nil
+	}
+
+	ev, err := json.Marshal([]interface{}{
+		time.Since(a.start).Seconds(), "o", string(data[:cut]),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := a.w.Write(append(ev, '\n')); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// the height for recordings, asciinema needs one even if it's unknown
+func recordHeight(h int) int {
+	if h <= 0 {
+		return 24
+	}
+	return h
+}
@@ -0,0 +1,42 @@
+package rawterm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAsciicastRecording(t *testing.T) {
+	rec := bytes.NewBuffer(nil)
+	rl, _ := newTestInstance(t, strings.NewReader("hi\r"), WithPrompt("> "), func(c *Config) {
+		c.FuncGetHeight = func() int { return 7 }
+	})
+	if err := rl.StartRecording(rec); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(rl.Stdout(), "é"[:1])
+	fmt.Fprint(rl.Stdout(), "é"[1:])
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	rl.StopRecording()
+	rl.Stdout().Write([]byte("not recorded"))
+
+	lines := strings.Split(strings.TrimSpace(rec.String()), "\n")
+	if !strings.HasPrefix(lines[0], `{"version":2,"width":80,"height":7,`) {
+		t.Fatal("header not expect", lines[0])
+	}
+	var out string
+	for _, l := range lines[1:] {
+		var ev []interface{}
+		if err := json.Unmarshal([]byte(l), &ev); err != nil || len(ev) != 3 || ev[1] != "o" {
+			t.Fatal("event not expect", l, err)
+		}
+		out += ev[2].(string)
+	}
+	if !strings.HasPrefix(out, "é") || !strings.Contains(out, "> hi") || strings.Contains(out, "not recorded") {
+		t.Fatalf("output not expect: %q", out)
+	}
+}
@@ -0,0 +1,72 @@
+package rawterm
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// In ChatMode the input stays on the terminal's last row, everything else
+// scrolls by in a region above it.
+
+// chatRows returns the height the scroll region was set up for, 0 if it
+// isn't.
+func (o *Operation) chatRows() int {
+	return int(atomic.LoadInt32(&o.chatHeight))
+}
+
+// chatSetup limits scrolling to the rows above the last one and moves the
+// cursor down there, it's left alone if the height isn't known.
+func (o *Operation) chatSetup() {
+	cfg := o.config()
+	h := cfg.FuncGetHeight()
+	if !cfg.ChatMode || h < 2 {
+		return
+	}
+	o.t.SetScrollRegion(1, h-1)
+	o.buf.Lock()
+	fmt.Fprintf(o.t, "\033[%d;1H\033[2K", h)
+	atomic.StoreInt32(&o.chatHeight, int32(h))
+	o.buf.Unlock()
+}
+
+// chatPrint writes b at the bottom of the scroll region and puts the cursor
+// back where it was. b always ends up as a whole line.
+func (o *Operation) chatPrint(target io.Writer, b []byte) (int, error) {
+	o.buf.Lock()
+	defer o.buf.Unlock()
+	out := regionLines(o.chatRows()-1, b)
+	if _, err := target.Write(out); err != nil {
+		return 0, err
+	}
+	o.t.recordOutput(out)
+	return len(b), nil
+}
+
+// chatEcho prints an accepted line above the input if FuncChatEcho wants
+// it to.
+func (o *Operation) chatEcho(line []rune) {
+	f := o.cfg.FuncChatEcho
+	if !o.cfg.ChatMode || f == nil {
+		return
+	}
+	s := f(line)
+	if o.chatRows() > 0 {
+		o.chatPrint(o.cfg.Stdout, []byte(s))
+		return
+	}
+	io.WriteString(o.t, s)
+}
+
+// chatReset gives the whole screen back for scrolling.
+func (o *Operation) chatReset() {
+	h := o.chatRows()
+	if h == 0 {
+		return
+	}
+	o.t.SetScrollRegion(0, 0)
+	o.buf.Lock()
+	fmt.Fprintf(o.t, "\033[%d;1H\033[2K", h)
+	atomic.StoreInt32(&o.chatHeight, 0)
+	o.buf.Unlock()
+}
@@ -0,0 +1,35 @@
+package rawterm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChatMode(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, out := newTestInstance(t, r, WithChatMode(func(line []rune) string {
+		return "me: " + string(line)
+	}))
+
+	go w.Write([]byte("hi\r"))
+	if line, err := rl.Readline(); err != nil || line != "hi" {
+		t.Fatal("result not expect", line, err)
+	}
+	fmt.Fprint(rl.Stdout(), "bob: yo")
+	rl.Close()
+
+	s := out.String()
+	for _, want := range []string{
+		"\0337\033[1;23r\0338\033[24;1H",
+		"\0337\033[23;1Hme: hi\n\0338",
+		"\0337\033[23;1Hbob: yo\n\0338",
+		"\0337\033[r\0338\033[24;1H",
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %q in %q", want, s)
+		}
+	}
+}
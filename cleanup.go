@@ -0,0 +1,163 @@
+package rawterm
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	cleanupLock sync.Mutex
+	instances   = make(map[*Instance]struct{})
+	cleanups    []func()
+
+	exitHandlers sync.Once
+
+	// the states taken by SaveState, by fd
+	savedStates map[int]*State
+)
+
+// SaveState takes a snapshot of the settings of stdin and stdout, which
+// RestoreState puts back. Call it at the start of the program, before any
+// Instance changed them. Streams which aren't terminals are skipped.
+func SaveState() error {
+	states := make(map[int]*State)
+	for _, fd := range []int{GetStdin(), int(syscall.Stdout)} {
+		if !IsTerminal(fd) {
+			continue
+		}
+		st, err := GetState(fd)
+		if err != nil {
+			return err
+		}
+		states[fd] = st
+	}
+	cleanupLock.Lock()
+	savedStates = states
+	cleanupLock.Unlock()
+	return nil
+}
+
+// RestoreState puts back the settings saved by SaveState, whatever the
+// Instances think the terminal is in, e.g. in a recover after a panic in a
+// listener. RestoreTerminals calls it too.
+func RestoreState() error {
+	cleanupLock.Lock()
+	states := savedStates
+	cleanupLock.Unlock()
+	if states == nil {
+		return errors.New("no terminal state saved")
+	}
+	var first error
+	for fd, st := range states {
+		if err := Restore(fd, st); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func registerInstance(i *Instance) {
+	cleanupLock.Lock()
+	instances[i] = struct{}{}
+	cleanupLock.Unlock()
+}
+
+func unregisterInstance(i *Instance) {
+	cleanupLock.Lock()
+	delete(instances, i)
+	cleanupLock.Unlock()
+}
+
+// AtExit registers f to be called by RestoreTerminals, which runs when a
+// panic is caught by Protect or Recover and on Exit.
+func AtExit(f func()) {
+	cleanupLock.Lock()
+	cleanups = append(cleanups, f)
+	cleanupLock.Unlock()
+}
+
+// RestoreTerminals leaves raw mode and shows the cursor for every Instance
+// which has not been closed yet, puts back the settings saved by SaveState,
+// then runs the functions given to AtExit.
+func RestoreTerminals() {
+	cleanupLock.Lock()
+	list := make([]*Instance, 0, len(instances))
+	for i := range instances {
+		list = append(list, i)
+	}
+	fs := cleanups
+	cleanupLock.Unlock()
+
+	for _, i := range list {
+		i.restore()
+	}
+	RestoreState()
+	for idx := len(fs) - 1; idx >= 0; idx-- {
+		fs[idx]()
+	}
+}
+
+// installExitHandlers makes the first SIGTERM or SIGHUP clean up before it
+// is raised again, which then ends the process as usual.
+func installExitHandlers() {
+	exitHandlers.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			sig := <-ch
+			RestoreTerminals()
+			cleanupLock.Lock()
+			list := make([]*Instance, 0, len(instances))
+			for i := range instances {
+				list = append(list, i)
+			}
+			cleanupLock.Unlock()
+			for _, i := range list {
+				i.Close()
+			}
+
+			signal.Stop(ch)
+			signal.Reset(sig)
+			if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(sig) != nil {
+				os.Exit(1)
+			}
+		}()
+	})
+}
+
+// Protect calls f, if it panics the terminals are restored before the panic
+// goes on so the user's shell isn't left in raw mode.
+func Protect(f func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			RestoreTerminals()
+			panic(err)
+		}
+	}()
+	f()
+}
+
+// Exit restores the terminals and exits the process with code.
+func Exit(code int) {
+	RestoreTerminals()
+	os.Exit(code)
+}
+
+// Recover restores the terminal if the goroutine is panicking, it must be
+// deferred directly:
+//
+// 	defer rl.Recover()
+func (i *Instance) Recover() {
+	if err := recover(); err != nil {
+		RestoreTerminals()
+		panic(err)
+	}
+}
+
+func (i *Instance) restore() {
+	i.Terminal.ForceRestore()
+	i.Terminal.ShowCursor()
+}
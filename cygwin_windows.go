@@ -0,0 +1,110 @@
+// +build windows
+
+package rawterm
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+const fileNameInfo = 2
+
+var procGetFileInformationByHandleEx = kernel32.NewProc("GetFileInformationByHandleEx")
+
+// isCygwin is set when stdin is a cygwin/msys pty (mintty, Git Bash), there is
+// no console behind it and it speaks plain ANSI like a unix terminal.
+var isCygwin bool
+
+// isCygwinTerminal reports whether fd is one of the named pipes cygwin and
+// msys use in place of a console, e.g. \msys-dd50a72ab4668b33-pty0-from-master
+func isCygwinTerminal(fd int) bool {
+	if t, _ := syscall.GetFileType(syscall.Handle(fd)); t != syscall.FILE_TYPE_PIPE {
+		return false
+	}
+
+	var info struct {
+		length uint32
+		name   [syscall.MAX_PATH]uint16
+	}
+	r, _, _ := syscall.Syscall6(procGetFileInformationByHandleEx.Addr(), 4,
+		uintptr(fd), fileNameInfo, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0, 0)
+	if r == 0 || int(info.length/2) > len(info.name) {
+		return false
+	}
+	name := string(utf16.Decode(info.name[:info.length/2]))
+
+	if !strings.HasPrefix(name, `\cygwin-`) && !strings.HasPrefix(name, `\msys-`) {
+		return false
+	}
+	if !strings.Contains(name, "-pty") {
+		return false
+	}
+	return strings.HasSuffix(name, "-from-master") || strings.HasSuffix(name, "-to-master")
+}
+
+// the pty lives inside the cygwin runtime, the only way to change its mode
+// from a native program is asking stty to do it for us.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func sttyGetState() (*State, error) {
+	old, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	return &State{stty: old}, nil
+}
+
+func sttyMakeRaw(flags RawModeFlags) (*State, error) {
+	state, err := sttyGetState()
+	if err != nil {
+		return nil, err
+	}
+	// same as MakeRaw on unix: keep OPOST so "\n" still returns the carriage
+	args := []string{"-icanon", "-echo", "-iexten", "-icrnl", "min", "1"}
+	if flags&RawKeepSignals == 0 {
+		args = append(args, "-isig")
+	}
+	if flags&RawKeepFlowControl == 0 {
+		args = append(args, "-ixon")
+	}
+	_, err = stty(args...)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func sttyRestore(state *State) error {
+	_, err := stty(state.stty)
+	return err
+}
+
+func sttyGetSize() (width, height int, err error) {
+	out, err := stty("size")
+	if err != nil {
+		return -1, -1, err
+	}
+	sp := strings.Fields(out)
+	if len(sp) != 2 {
+		return -1, -1, syscall.EINVAL
+	}
+	height, err = strconv.Atoi(sp[0])
+	if err != nil {
+		return -1, -1, err
+	}
+	width, err = strconv.Atoi(sp[1])
+	if err != nil {
+		return -1, -1, err
+	}
+	return width, height, nil
+}
@@ -0,0 +1,196 @@
+package rawterm
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// InvalidUTF8Policy decides what happens to input bytes which aren't valid
+// UTF-8.
+type InvalidUTF8Policy int
+
+const (
+	// InvalidUTF8Replace reports each invalid byte as U+FFFD.
+	InvalidUTF8Replace InvalidUTF8Policy = iota
+	// InvalidUTF8Skip drops invalid bytes.
+	InvalidUTF8Skip
+	// InvalidUTF8Raw reports an invalid byte b as the rune 0xDC00+b, which
+	// RawByte turns back into the byte. It's how Python's surrogateescape
+	// keeps undecodable bytes.
+	InvalidUTF8Raw
+)
+
+// RawByte returns the byte r stands for with InvalidUTF8Raw.
+func RawByte(r rune) (b byte, ok bool) {
+	if r < 0xDC80 || r > 0xDCFF {
+		return 0, false
+	}
+	return byte(r - 0xDC00), true
+}
+
+// Encoding converts between runes and the bytes a terminal which doesn't
+// use UTF-8 sends and expects, see Config.InputEncoding.
+type Encoding interface {
+	// Decode returns the first rune in p and its length, size is 0 if p
+	// is the start of a longer sequence.
+	Decode(p []byte) (r rune, size int)
+	// Encode appends r to dst.
+	Encode(dst []byte, r rune) []byte
+}
+
+// Charmap is a single byte Encoding which is ASCII in the lower half, it
+// has the runes for the bytes 0x80-0xff.
+type Charmap [128]rune
+
+func (c *Charmap) Decode(p []byte) (rune, int) {
+	if p[0] < 0x80 {
+		return rune(p[0]), 1
+	}
+	return c[p[0]-0x80], 1
+}
+
+func (c *Charmap) Encode(dst []byte, r rune) []byte {
+	if r < 0x80 {
+		return append(dst, byte(r))
+	}
+	for i, cr := range c {
+		if cr == r {
+			return append(dst, byte(0x80+i))
+		}
+	}
+	return append(dst, '?')
+}
+
+// Latin1 is ISO-8859-1, where each byte is the rune with its value.
+var Latin1 = func() *Charmap {
+	var c Charmap
+	for i := range c {
+		c[i] = rune(0x80 + i)
+	}
+	return &c
+}()
+
+// CP437 is the code page of the IBM PC and DOS consoles.
+var CP437 = &Charmap{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', '\u00a0',
+}
+
+// inputDecoder reads runes byte by byte, a sequence split by a canceled
+// read is kept until the rest arrives.
+type inputDecoder struct {
+	partial []byte
+}
+
+// readRune reads the next rune, in UTF-8 if enc is nil.
+func (d *inputDecoder) readRune(buf *bufio.Reader, enc Encoding, policy InvalidUTF8Policy) (rune, error) {
+	if enc != nil {
+		return d.readEncoded(buf, enc)
+	}
+	for {
+		if len(d.partial) > 0 && utf8.FullRune(d.partial) {
+			r, size := utf8.DecodeRune(d.partial)
+			b0 := d.partial[0]
+			d.partial = d.partial[size:]
+			if r != utf8.RuneError || size != 1 {
+				return r, nil
+			}
+			if r, ok := d.invalid(b0, policy); ok {
+				return r, nil
+			}
+			continue
+		}
+		b, err := buf.ReadByte()
+		if err == io.EOF && len(d.partial) > 0 {
+			// the input ended in the middle of a sequence
+			b0 := d.partial[0]
+			d.partial = d.partial[1:]
+			if r, ok := d.invalid(b0, policy); ok {
+				return r, nil
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(d.partial) == 0 && b < utf8.RuneSelf {
+			return rune(b), nil
+		}
+		d.partial = append(d.partial, b)
+	}
+}
+
+func (d *inputDecoder) readEncoded(buf *bufio.Reader, enc Encoding) (rune, error) {
+	for {
+		if len(d.partial) > 0 {
+			if r, size := enc.Decode(d.partial); size > 0 {
+				d.partial = d.partial[size:]
+				return r, nil
+			}
+		}
+		b, err := buf.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		d.partial = append(d.partial, b)
+	}
+}
+
+// invalid returns the rune for the invalid byte b, ok is false if it's
+// dropped.
+func (d *inputDecoder) invalid(b byte, policy InvalidUTF8Policy) (r rune, ok bool) {
+	switch policy {
+	case InvalidUTF8Skip:
+		return 0, false
+	case InvalidUTF8Raw:
+		return 0xDC00 + rune(b), true
+	}
+	return utf8.RuneError, true
+}
+
+// encodeOutput wraps w to write enc, a writer wrapped before is unwrapped
+// first.
+func encodeOutput(w io.Writer, enc Encoding) io.Writer {
+	if e, ok := w.(*encodeWriter); ok {
+		w = e.w
+	}
+	if enc == nil {
+		return w
+	}
+	return &encodeWriter{w: w, enc: enc}
+}
+
+// encodeWriter converts the UTF-8 written to it to enc.
+type encodeWriter struct {
+	w   io.Writer
+	enc Encoding
+
+	m sync.Mutex
+	// the start of a rune split between writes
+	partial []byte
+}
+
+func (e *encodeWriter) Write(b []byte) (int, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	p := append(e.partial, b...)
+	var out []byte
+	for len(p) > 0 && utf8.FullRune(p) {
+		r, size := utf8.DecodeRune(p)
+		out = e.enc.Encode(out, r)
+		p = p[size:]
+	}
+	e.partial = append(e.partial[:0], p...)
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
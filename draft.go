@@ -0,0 +1,122 @@
+package rawterm
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// DraftStore keeps the line being typed so it survives a crash, see
+// Config.Drafts. An empty draft means there's nothing to restore.
+type DraftStore interface {
+	SaveDraft(line string) error
+	LoadDraft() (string, error)
+}
+
+// DraftFile is a DraftStore which keeps the draft in a file, the file is
+// removed when the draft is empty.
+type DraftFile string
+
+func (f DraftFile) SaveDraft(line string) error {
+	if line == "" {
+		err := os.Remove(string(f))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(string(f), []byte(line), 0600)
+}
+
+func (f DraftFile) LoadDraft() (string, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(b), err
+}
+
+// draftSaver saves the line DraftDelay after it last changed.
+type draftSaver struct {
+	m     sync.Mutex
+	timer *time.Timer
+	// the line as last saved or scheduled to be
+	line string
+	// counts the timers started, so a stale one does nothing
+	gen int
+}
+
+// draftRestore puts a saved draft into the empty buffer when a read
+// starts.
+func (o *Operation) draftRestore() {
+	cfg := o.config()
+	if cfg.Drafts == nil || o.buf.Len() > 0 {
+		return
+	}
+	line, err := cfg.Drafts.LoadDraft()
+	if err != nil || line == "" {
+		return
+	}
+	d := &o.draft
+	d.m.Lock()
+	d.line = line
+	d.m.Unlock()
+	o.buf.Set([]rune(line))
+	o.buf.SetHint(cfg.DraftHint)
+}
+
+// draftChanged is called after each key, with o.m held.
+func (o *Operation) draftChanged() {
+	if o.cfg.Drafts == nil {
+		return
+	}
+	line := string(o.buf.Runes())
+	d := &o.draft
+	d.m.Lock()
+	defer d.m.Unlock()
+	if line == d.line {
+		return
+	}
+	d.line = line
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.gen++
+	gen, store := d.gen, o.cfg.Drafts
+	delay := o.cfg.DraftDelay
+	if delay <= 0 {
+		delay = 500 * time.Millisecond
+	}
+	d.timer = time.AfterFunc(delay, func() {
+		d.m.Lock()
+		defer d.m.Unlock()
+		if d.gen == gen {
+			d.timer = nil
+			store.SaveDraft(line)
+		}
+	})
+}
+
+// draftFlush saves a pending draft to store right away, done means the
+// line was entered and the draft is cleared.
+func (o *Operation) draftFlush(store DraftStore, done bool) {
+	if store == nil {
+		return
+	}
+	d := &o.draft
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.timer == nil && (!done || d.line == "") {
+		return
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+	if done {
+		d.line = ""
+	}
+	store.SaveDraft(d.line)
+}
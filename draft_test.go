@@ -0,0 +1,57 @@
+package rawterm
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memDraft struct {
+	sync.Mutex
+	line string
+}
+
+func (m *memDraft) SaveDraft(line string) error {
+	m.Lock()
+	m.line = line
+	m.Unlock()
+	return nil
+}
+
+func (m *memDraft) LoadDraft() (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.line, nil
+}
+
+func TestDrafts(t *testing.T) {
+	store := &memDraft{}
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, _ := newTestInstance(t, r, func(c *Config) {
+		c.Drafts = store
+		c.DraftDelay = 10 * time.Millisecond
+	})
+
+	go func() {
+		w.Write([]byte("abc"))
+		time.Sleep(50 * time.Millisecond)
+		if line, _ := store.LoadDraft(); line != "abc" {
+			t.Error("draft not saved", line)
+		}
+		w.Write([]byte("\r"))
+	}()
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := store.LoadDraft(); line != "" {
+		t.Fatal("draft not cleared", line)
+	}
+
+	store.SaveDraft("xyz")
+	go w.Write([]byte("!\r"))
+	if line, err := rl.Readline(); err != nil || line != "xyz!" {
+		t.Fatal("draft not restored", line, err)
+	}
+}
@@ -0,0 +1,241 @@
+package rawterm
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// ExpandLine expands $VAR, ${VAR} and a leading ~ or ~user in each word of
+// line the way a shell would. Nothing inside single quotes is expanded, nor
+// are unset variables, which are left as they are.
+func ExpandLine(line string) string {
+	rs := []rune(line)
+	out := make([]rune, 0, len(rs))
+	quoted := false
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '$':
+			if name, n := varName(rs[i+1:]); n > 0 {
+				if v, ok := os.LookupEnv(name); ok {
+					out = append(out, []rune(v)...)
+					i += n
+					continue
+				}
+			}
+		case c == '~' && (i == 0 || rs[i-1] == ' ' || rs[i-1] == '='):
+			end := i + 1
+			for end < len(rs) && rs[end] != '/' && rs[end] != ' ' {
+				end++
+			}
+			if home := homeDir(string(rs[i+1 : end])); home != "" {
+				out = append(out, []rune(home)...)
+				i = end - 1
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// varName parses the name after a $, it returns the name and how many
+// runes it took including braces, 0 if there's no valid name.
+func varName(rs []rune) (string, int) {
+	if len(rs) > 0 && rs[0] == '{' {
+		for i := 1; i < len(rs); i++ {
+			if rs[i] == '}' {
+				if i == 1 {
+					return "", 0
+				}
+				return string(rs[1:i]), i + 1
+			}
+		}
+		return "", 0
+	}
+	n := 0
+	for n < len(rs) && isVarRune(rs[n], n == 0) {
+		n++
+	}
+	return string(rs[:n]), n
+}
+
+func isVarRune(r rune, first bool) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+		!first && r >= '0' && r <= '9'
+}
+
+// homeDir returns the home of name, or of the current user if it's empty.
+func homeDir(name string) string {
+	if name == "" {
+		home, _ := os.UserHomeDir()
+		return home
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return ""
+	}
+	return u.HomeDir
+}
+
+// CompleteEnv is a KeyHandler completing the name of the environment
+// variable before the cursor, e.g. $HO to $HOME. If several variables
+// match it completes their common prefix. Bind it to Tab with
+//
+//	cfg.Bind(KeyEvent{Rune: CharTab}, CompleteEnv)
+func CompleteEnv(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+	start := pos
+	for start > 0 && isVarRune(line[start-1], false) {
+		start--
+	}
+	braced := start > 0 && line[start-1] == '{'
+	if braced {
+		start--
+	}
+	if start == 0 || line[start-1] != '$' {
+		return nil, 0, false
+	}
+	prefix := string(line[start:pos])
+	if braced {
+		prefix = prefix[1:]
+	}
+
+	var names []string
+	for _, kv := range os.Environ() {
+		name := kv[:strings.IndexByte(kv, '=')]
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, 0, false
+	}
+	sort.Strings(names)
+	common := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	add := []rune(common[len(prefix):])
+	if len(names) == 1 && braced {
+		add = append(add, '}')
+	}
+	newLine := append(append(append([]rune(nil), line[:pos]...), add...), line[pos:]...)
+	return newLine, pos + len(add), true
+}
+
+var (
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	ErrTrailingBackslash = errors.New("line ends in a backslash")
+)
+
+// SplitArgs splits line into words the way a shell would, without
+// expanding anything. Words are separated by blanks, which are kept inside
+// single or double quotes or after a backslash. Inside double quotes a
+// backslash only escapes $, `, " and \. If line ends in an open quote or a
+// backslash it returns the words so far, the last one unfinished, with
+// ErrUnterminatedQuote or ErrTrailingBackslash, e.g. to tell that a line
+// needs continuing.
+func SplitArgs(line string) ([]string, error) {
+	var (
+		args []string
+		word []rune
+		// a word started, it may still be empty like ''
+		inWord bool
+		quote  rune
+	)
+	rs := []rune(line)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\\':
+			if i+1 == len(rs) {
+				return append(args, string(word)), ErrTrailingBackslash
+			}
+			next := rs[i+1]
+			if quote == '"' && !strings.ContainsRune("$`\"\\", next) {
+				word = append(word, c)
+				continue
+			}
+			word = append(word, next)
+			inWord = true
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, string(word))
+				word, inWord = word[:0], false
+			}
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return append(args, string(word)), ErrUnterminatedQuote
+	}
+	if inWord {
+		args = append(args, string(word))
+	}
+	return args, nil
+}
+
+// DefaultWordBreaks are the runes WordAt ends words at, like the
+// completer word break characters of GNU readline.
+const DefaultWordBreaks = " \t\n\"'`@$><=;|&{("
+
+// WordAt returns the word before pos and where it starts, e.g. for a
+// completer to find what to complete. See WordAtBreaks.
+func WordAt(line []rune, pos int) (word []rune, start int) {
+	return WordAtBreaks(line, pos, DefaultWordBreaks)
+}
+
+// WordAtBreaks is WordAt with the runes in breaks ending words. A break
+// after a backslash or inside quotes doesn't end the word, if pos is inside
+// quotes the word starts after the opening quote.
+func WordAtBreaks(line []rune, pos int, breaks string) (word []rune, start int) {
+	var quote rune
+	for i := 0; i < pos; i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				start = i + 1
+			} else if c == '\\' && quote == '"' && i+1 < pos {
+				i++
+			}
+		case c == '\\':
+			if i+1 < pos {
+				i++
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			start = i + 1
+		case strings.ContainsRune(breaks, c):
+			start = i + 1
+		}
+	}
+	return line[start:pos], start
+}
@@ -0,0 +1,126 @@
+package rawterm
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExpandLine(t *testing.T) {
+	t.Setenv("RAWTERM_A", "x y")
+	t.Setenv("RAWTERM_UNSET", "")
+	os.Unsetenv("RAWTERM_UNSET")
+	home, _ := os.UserHomeDir()
+	for _, c := range [][2]string{
+		{"echo $RAWTERM_A ${RAWTERM_A}z", "echo x y x yz"},
+		{"echo '$RAWTERM_A' $RAWTERM_UNSET $ ${}", "echo '$RAWTERM_A' $RAWTERM_UNSET $ ${}"},
+		{"cd ~/src a~b", "cd " + home + "/src a~b"},
+	} {
+		if got := ExpandLine(c[0]); got != c[1] {
+			t.Fatalf("result not expect: %q -> %q", c[0], got)
+		}
+	}
+}
+
+func TestCompleteEnv(t *testing.T) {
+	t.Setenv("RAWTERM_COMPLETE_ONE", "1")
+	t.Setenv("RAWTERM_COMPLETE_TWO", "2")
+	for _, c := range [][2]string{
+		{"echo $RAWTERM_COMP", "echo $RAWTERM_COMPLETE_"},
+		{"echo ${RAWTERM_COMPLETE_O", "echo ${RAWTERM_COMPLETE_ONE}"},
+	} {
+		line := []rune(c[0])
+		got, pos, ok := CompleteEnv(line, len(line), KeyEvent{Rune: CharTab})
+		if !ok || string(got) != c[1] || pos != len(got) {
+			t.Fatal("result not expect", c[0], string(got), pos, ok)
+		}
+	}
+	if _, _, ok := CompleteEnv([]rune("RAWTERM"), 7, KeyEvent{Rune: CharTab}); ok {
+		t.Fatal("completed without $")
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		args []string
+		err  error
+	}{
+		{`  ls -l  /tmp `, []string{"ls", "-l", "/tmp"}, nil},
+		{`echo 'a b' "c d" e\ f`, []string{"echo", "a b", "c d", "e f"}, nil},
+		{`x '' "" y`, []string{"x", "", "", "y"}, nil},
+		{`"a\"b\n" 'c\d'`, []string{`a"b\n`, `c\d`}, nil},
+		{`a"b"'c'`, []string{"abc"}, nil},
+		{`echo "open`, []string{"echo", "open"}, ErrUnterminatedQuote},
+		{`echo 'it`, []string{"echo", "it"}, ErrUnterminatedQuote},
+		{`cd \`, []string{"cd", ""}, ErrTrailingBackslash},
+	} {
+		args, err := SplitArgs(c.line)
+		if err != c.err || strings.Join(args, "|") != strings.Join(c.args, "|") || len(args) != len(c.args) {
+			t.Errorf("%s: got %q %v", c.line, args, err)
+		}
+	}
+}
+
+func TestWordAt(t *testing.T) {
+	for _, c := range []struct {
+		line, word string
+		start      int
+	}{
+		{"git chec", "chec", 4},
+		{"git ", "", 4},
+		{`cat my\ fi`, `my\ fi`, 4},
+		{`cat "my fi`, "my fi", 5},
+		{`x="a b" y=c`, "c", 10},
+		{"echo $HO", "HO", 6},
+	} {
+		line := []rune(c.line)
+		if word, start := WordAt(line, len(line)); string(word) != c.word || start != c.start {
+			t.Errorf("%s: got %q %d", c.line, string(word), start)
+		}
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	cands := []string{"Status", "stash", "cherry-pick", "show-branch"}
+	for _, c := range []struct {
+		m     Matcher
+		typed string
+		want  string
+	}{
+		{MatchPrefix, "st", "stash"},
+		{MatchIgnoreCase, "st", "Status,stash"},
+		{MatchSmartCase, "St", "Status"},
+		{MatchFuzzy, "sa", "Status,stash,show-branch"},
+		{MatchFuzzy, "chp", "cherry-pick"},
+	} {
+		if got := strings.Join(MatchAll(c.m, c.typed, cands), ","); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.typed, got, c.want)
+		}
+	}
+	_, pos, _ := MatchFuzzy("shbr", "show-branch")
+	if s := HighlightMatch("show-branch", pos, "[", "]"); s != "[sh]ow-[br]anch" {
+		t.Fatal("highlight not expect", s)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		dist int
+	}{
+		{"status", "status", 0},
+		{"stauts", "status", 1},
+		{"stat", "status", 2},
+		{"", "abc", 3},
+		{"ca", "abc", 3},
+	} {
+		if d := EditDistance(c.a, c.b); d != c.dist {
+			t.Errorf("%s %s: got %d, want %d", c.a, c.b, d, c.dist)
+		}
+	}
+	got := Suggest("stauts", []string{"stash", "status", "stats", "commit"}, 2)
+	if strings.Join(got, ",") != "status,stats" {
+		t.Fatal("suggestions not expect", got)
+	}
+}
@@ -0,0 +1,167 @@
+// +build darwin dragonfly freebsd linux,!appengine netbsd openbsd
+
+package rawterm
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// FdReader reads from a file descriptor after waiting for it with select(2)
+// together with a self-pipe, so a blocked Read returns immediately on Cancel
+// or Close. No goroutine is involved, so nothing is read behind the caller's
+// back and no data can be lost.
+//
+// The descriptor is not switched to O_NONBLOCK: it's usually shared with the
+// parent shell and select already guarantees the read won't block. select
+// only takes descriptors below 1024, NewFdReader fails for others.
+type FdReader struct {
+	fd      int
+	wake    [2]int
+	mutex   sync.Mutex
+	waiting int32
+	closed  int32
+}
+
+func NewFdReader(fd int) (*FdReader, error) {
+	if fd < 0 || fd >= fdSetSize {
+		return nil, errFdSetSize
+	}
+	f := &FdReader{fd: fd}
+	if err := syscall.Pipe(f.wake[:]); err != nil {
+		return nil, err
+	}
+	if f.wake[0] >= fdSetSize {
+		syscall.Close(f.wake[0])
+		syscall.Close(f.wake[1])
+		return nil, errFdSetSize
+	}
+	for _, p := range f.wake {
+		syscall.SetNonblock(p, true)
+		syscall.CloseOnExec(p)
+	}
+	return f, nil
+}
+
+// use the select based reader for os.Stdin, it can be canceled without
+// leaving a goroutine blocked on it.
+func newStdinReader(r io.Reader) io.Reader {
+	if f, ok := r.(*os.File); ok {
+		if fr, err := NewFdReader(int(f.Fd())); err == nil {
+			return fr
+		}
+	}
+	return NewCancelableStdin(r)
+}
+
+func (f *FdReader) Read(b []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// the self-pipe is gone once closed
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, io.EOF
+	}
+	f.drain()
+	for {
+		if atomic.LoadInt32(&f.closed) == 1 {
+			return 0, io.EOF
+		}
+
+		var set syscall.FdSet
+		fdSet(&set, f.fd)
+		fdSet(&set, f.wake[0])
+		n := f.fd
+		if f.wake[0] > n {
+			n = f.wake[0]
+		}
+
+		atomic.StoreInt32(&f.waiting, 1)
+		err := sysSelect(n+1, &set)
+		atomic.StoreInt32(&f.waiting, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if fdIsSet(&set, f.wake[0]) {
+			f.drain()
+			if atomic.LoadInt32(&f.closed) == 1 {
+				return 0, io.EOF
+			}
+			return 0, ErrCanceled
+		}
+		if !fdIsSet(&set, f.fd) {
+			continue
+		}
+		n, err = syscall.Read(f.fd, b)
+		if err == syscall.EINTR || err == syscall.EAGAIN {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+		return n, nil
+	}
+}
+
+// drain empties the self-pipe, a wakeup which raced with the end of the
+// previous Read must not cancel the next one.
+func (f *FdReader) drain() {
+	var buf [16]byte
+	for {
+		n, _ := syscall.Read(f.wake[0], buf[:])
+		if n <= 0 {
+			return
+		}
+	}
+}
+
+// Cancel makes a Read which is waiting for data return ErrCanceled. It has no
+// effect if there is none.
+func (f *FdReader) Cancel() {
+	if atomic.LoadInt32(&f.waiting) == 1 {
+		syscall.Write(f.wake[1], []byte{0})
+	}
+}
+
+// Close makes all reads return io.EOF, the file descriptor itself is left
+// open.
+func (f *FdReader) Close() error {
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return nil
+	}
+	syscall.Write(f.wake[1], []byte{0})
+
+	// wait for a pending Read to notice
+	f.mutex.Lock()
+	syscall.Close(f.wake[0])
+	syscall.Close(f.wake[1])
+	f.mutex.Unlock()
+	return nil
+}
+
+// fdSetSize is FD_SETSIZE, the size of a syscall.FdSet.
+const fdSetSize = 1024
+
+var errFdSetSize = errors.New("file descriptor too large for select")
+
+func fdSet(set *syscall.FdSet, fd int) {
+	bits := (*[fdSetSize / fdMaskBits]fdMask)(unsafe.Pointer(set))
+	bits[fd/fdMaskBits] |= 1 << (uint(fd) % fdMaskBits)
+}
+
+func fdIsSet(set *syscall.FdSet, fd int) bool {
+	bits := (*[fdSetSize / fdMaskBits]fdMask)(unsafe.Pointer(set))
+	return bits[fd/fdMaskBits]&(1<<(uint(fd)%fdMaskBits)) != 0
+}
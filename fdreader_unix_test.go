@@ -0,0 +1,74 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package rawterm
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFdReader(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	f, err := NewFdReader(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Cancel()
+	}()
+	buf := make([]byte, 16)
+	if _, err := f.Read(buf); err != ErrCanceled {
+		t.Fatal("result not expect", err)
+	}
+
+	w.Write([]byte("abc"))
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "abc" {
+		t.Fatal("result not expect", string(buf[:n]), err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err := f.Read(buf); err != io.EOF {
+		t.Fatal("result not expect", err)
+	}
+	if _, err := f.Read(buf); err != io.EOF {
+		t.Fatal("result not expect", err)
+	}
+
+	// select can't wait for it
+	if _, err := NewFdReader(fdSetSize); err != errFdSetSize {
+		t.Fatal("error not expect", err)
+	}
+}
+
+func TestInitOpensNothing(t *testing.T) {
+	fds := func() int {
+		d, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("no /proc/self/fd")
+		}
+		return len(d)
+	}
+	before := fds()
+	for i := 0; i < 50; i++ {
+		if err := (&Config{}).Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fds(); n > before {
+		t.Fatal("fds leaked", n-before)
+	}
+}
@@ -0,0 +1,56 @@
+package rawterm
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+// newTestInstance makes an Instance reading in and writing to the
+// returned buffer, it's closed when the test ends.
+func newTestInstance(t testing.TB, in io.Reader, opts ...Option) (*Instance, *syncBuffer) {
+	out := new(syncBuffer)
+	rl, err := NewWithStreams(in, out, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rl.Close() })
+	return rl, out
+}
+
+// syncBuffer is a bytes.Buffer the read loop can write to while the test
+// reads it.
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+// keyRecorder is a KeyListener keeping every key it sees.
+type keyRecorder struct {
+	sync.Mutex
+	keys []KeyEvent
+}
+
+func (k *keyRecorder) OnChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+	return nil, 0, false
+}
+
+func (k *keyRecorder) OnKey(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+	k.Lock()
+	k.keys = append(k.keys, key)
+	k.Unlock()
+	return nil, 0, false
+}
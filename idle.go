@@ -0,0 +1,85 @@
+package rawterm
+
+import (
+	"sync"
+	"time"
+)
+
+// idleWatch calls Config.FuncOnIdle while no key is pressed during a read.
+type idleWatch struct {
+	m     sync.Mutex
+	timer *time.Timer
+	// counts the timers started, so a stale one does nothing
+	gen int
+	// the last key press, or when the read started
+	last time.Time
+	// FuncOnIdle was called since the last key press
+	idle bool
+}
+
+// arm starts the timer, it's called with w.m held.
+func (o *Operation) idleArm(d time.Duration) {
+	w := &o.idle
+	w.gen++
+	gen := w.gen
+	w.timer = time.AfterFunc(d, func() { o.idleFire(gen) })
+}
+
+// idleStart is called when a read starts.
+func (o *Operation) idleStart() {
+	cfg := o.config()
+	if cfg.IdleTimeout <= 0 || cfg.FuncOnIdle == nil {
+		return
+	}
+	w := &o.idle
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.last, w.idle = time.Now(), false
+	o.idleArm(cfg.IdleTimeout)
+}
+
+// idleStop is called when a read returns.
+func (o *Operation) idleStop() {
+	w := &o.idle
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+func (o *Operation) idleFire(gen int) {
+	cfg := o.config()
+	w := &o.idle
+	w.m.Lock()
+	if w.timer == nil || w.gen != gen {
+		// stopped or reset in the meantime
+		w.m.Unlock()
+		return
+	}
+	d := time.Since(w.last)
+	w.idle = true
+	o.idleArm(cfg.IdleTimeout)
+	w.m.Unlock()
+	cfg.FuncOnIdle(d)
+}
+
+// idleActive is called for every key typed.
+func (o *Operation) idleActive() {
+	cfg := o.config()
+	w := &o.idle
+	w.m.Lock()
+	if w.timer == nil {
+		w.m.Unlock()
+		return
+	}
+	w.timer.Stop()
+	wasIdle, d := w.idle, time.Since(w.last)
+	w.last, w.idle = time.Now(), false
+	o.idleArm(cfg.IdleTimeout)
+	w.m.Unlock()
+	if wasIdle && cfg.FuncOnActivity != nil {
+		cfg.FuncOnActivity(d)
+	}
+}
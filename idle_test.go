@@ -0,0 +1,36 @@
+package rawterm
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOnIdle(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	idle := make(chan time.Duration, 10)
+	active := make(chan time.Duration, 1)
+	rl, _ := newTestInstance(t, r,
+		WithOnIdle(20*time.Millisecond, func(d time.Duration) { idle <- d }),
+		func(c *Config) { c.FuncOnActivity = func(d time.Duration) { active <- d } })
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("a\r"))
+	}()
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	if len(idle) < 1 {
+		t.Fatal("FuncOnIdle not called")
+	}
+	if d := <-active; d < 40*time.Millisecond {
+		t.Fatal("idle time not expect", d)
+	}
+	n := len(idle)
+	time.Sleep(50 * time.Millisecond)
+	if len(idle) != n {
+		t.Fatal("FuncOnIdle called after the read")
+	}
+}
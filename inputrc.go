@@ -0,0 +1,264 @@
+package rawterm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the readline functions a key can be bound to in an inputrc file, by the
+// key which does the same here
+var inputrcFuncs = map[string]rune{
+	"beginning-of-line":    CharLineStart,
+	"end-of-line":          CharLineEnd,
+	"forward-char":         CharForward,
+	"backward-char":        CharBackward,
+	"forward-word":         MetaForward,
+	"backward-word":        MetaBackward,
+	"kill-line":            CharKill,
+	"unix-line-discard":    CharCtrlU,
+	"kill-word":            MetaDelete,
+	"backward-kill-word":   MetaBackspace,
+	"unix-word-rubout":     CharCtrlW,
+	"delete-char":          CharDelete,
+	"backward-delete-char": CharBackspace,
+	"transpose-chars":      CharTranspose,
+	"clear-screen":         CharCtrlL,
+	"accept-line":          CharEnter,
+}
+
+// InputrcPath returns the inputrc file GNU readline would read, $INPUTRC
+// or ~/.inputrc.
+func InputrcPath() string {
+	if p := os.Getenv("INPUTRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".inputrc")
+}
+
+// LoadInputrcFile is LoadInputrc reading the file at path.
+func (c *Config) LoadInputrcFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.LoadInputrc(f)
+}
+
+// LoadInputrc applies the key bindings of a GNU readline inputrc file to
+// KeyMap, e.g.
+//
+// 	"\C-b": backward-word
+// 	Meta-d: kill-line
+//
+// Only keys and functions this package has are supported, as are $if
+// blocks for mode=emacs and term=. Settings like editing-mode and the
+// bindings of other applications are skipped. The first line which can't
+// be used is returned as an error after the rest are applied.
+func (c *Config) LoadInputrc(r io.Reader) error {
+	var firstErr error
+	fail := func(n int, format string, a ...interface{}) {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("inputrc line %d: %s", n, fmt.Sprintf(format, a...))
+		}
+	}
+	// whether each enclosing $if applies
+	var cond []bool
+	active := func() bool {
+		for _, c := range cond {
+			if !c {
+				return false
+			}
+		}
+		return true
+	}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || line[0] == '#':
+		case strings.HasPrefix(line, "$if"):
+			test := strings.TrimSpace(line[3:])
+			cond = append(cond, test == "mode=emacs" || strings.HasPrefix(test, "term="))
+		case line == "$else":
+			if len(cond) > 0 {
+				cond[len(cond)-1] = !cond[len(cond)-1]
+			}
+		case line == "$endif":
+			if len(cond) > 0 {
+				cond = cond[:len(cond)-1]
+			}
+		case !active():
+		case strings.HasPrefix(line, "$"), strings.HasPrefix(line, "set "):
+			// $include and settings, none of which apply here
+		default:
+			key, fn, err := parseInputrcBinding(line)
+			if err != nil {
+				fail(n, "%v", err)
+				continue
+			}
+			r, ok := inputrcFuncs[fn]
+			if !ok {
+				fail(n, "unsupported function %q", fn)
+				continue
+			}
+			if c.KeyMap == nil {
+				c.KeyMap = make(map[KeyEvent]rune)
+			}
+			c.KeyMap[key] = r
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// parseInputrcBinding parses `"keyseq": function` and `keyname: function`.
+func parseInputrcBinding(line string) (KeyEvent, string, error) {
+	var seq []byte
+	var rest string
+	if line[0] == '"' {
+		end := strings.Index(line[1:], `":`)
+		if end < 0 {
+			return KeyEvent{}, "", fmt.Errorf("bad binding %q", line)
+		}
+		seq = unescapeInputrc(line[1 : end+1])
+		rest = line[end+3:]
+	} else {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return KeyEvent{}, "", fmt.Errorf("bad binding %q", line)
+		}
+		var ok bool
+		if seq, ok = inputrcKeyName(line[:i]); !ok {
+			return KeyEvent{}, "", fmt.Errorf("unknown key %q", line[:i])
+		}
+		rest = line[i+1:]
+	}
+	fn := strings.TrimSpace(rest)
+	if strings.HasPrefix(fn, `"`) {
+		return KeyEvent{}, "", fmt.Errorf("macros are not supported")
+	}
+	key, ok := decodeKeySequence(seq)
+	if !ok {
+		return KeyEvent{}, "", fmt.Errorf("key sequence %q is not a single key", seq)
+	}
+	return key, fn, nil
+}
+
+// unescapeInputrc handles \C-x, \M-x, \e and the C escapes in a key
+// sequence.
+func unescapeInputrc(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch {
+		case strings.HasPrefix(s[i:], "C-") && i+2 < len(s):
+			out = append(out, s[i+2]&0x1f)
+			i += 2
+		case strings.HasPrefix(s[i:], "M-") && i+2 < len(s):
+			out = append(out, CharEsc, s[i+2])
+			i += 2
+		case s[i] == 'e':
+			out = append(out, CharEsc)
+		case s[i] == 't':
+			out = append(out, '\t')
+		case s[i] == 'n':
+			out = append(out, '\n')
+		case s[i] == 'r':
+			out = append(out, '\r')
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out
+}
+
+// inputrcKeyName turns Control-a, Meta-Rubout, C-u and the like into the
+// bytes the key sends.
+func inputrcKeyName(name string) ([]byte, bool) {
+	var meta, ctrl bool
+	for {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			ctrl, name = true, name[8:]
+			continue
+		case strings.HasPrefix(lower, "c-"):
+			ctrl, name = true, name[2:]
+			continue
+		case strings.HasPrefix(lower, "meta-"):
+			meta, name = true, name[5:]
+			continue
+		case strings.HasPrefix(lower, "m-"):
+			meta, name = true, name[2:]
+			continue
+		}
+		break
+	}
+	var b byte
+	switch strings.ToLower(name) {
+	case "rubout", "del":
+		b = CharBackspace
+	case "escape", "esc":
+		b = CharEsc
+	case "return", "ret", "newline":
+		b = CharEnter
+	case "space", "spc":
+		b = ' '
+	case "tab":
+		b = CharTab
+	default:
+		if len(name) != 1 {
+			return nil, false
+		}
+		b = name[0]
+	}
+	if ctrl {
+		b &= 0x1f
+	}
+	if meta {
+		return []byte{CharEsc, b}, true
+	}
+	return []byte{b}, true
+}
+
+// decodeKeySequence decodes what a single key press sends the way the
+// terminal does.
+func decodeKeySequence(seq []byte) (KeyEvent, bool) {
+	buf := bufio.NewReader(bytes.NewReader(seq))
+	r, _, err := buf.ReadRune()
+	if err != nil {
+		return KeyEvent{}, false
+	}
+	ev := KeyEvent{Rune: r}
+	if r == CharEsc && buf.Buffered() > 0 {
+		r, _, _ = buf.ReadRune()
+		if r == CharEscapeEx {
+			r, _, _ = buf.ReadRune()
+			key := readEscKey(r, buf)
+			ev = KeyEvent{Rune: escapeExKey(key), Mod: keyModifier(key)}
+			if ext, ok := extendedKey(key); ok {
+				ev = ext
+			}
+		} else {
+			ev = escapeKey(r, buf, nil)
+		}
+	}
+	return ev, ev.Rune != 0 && buf.Buffered() == 0
+}
@@ -0,0 +1,52 @@
+package rawterm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadInputrc(t *testing.T) {
+	rc := `# comment
+set editing-mode vi
+set completion-ignore-case on
+"\C-b": beginning-of-line
+Meta-k: kill-line
+"\e[1;5D": backward-word
+$if mode=vi
+"\C-e": backward-char
+$else
+Control-e: end-of-line
+$endif
+$if Bash
+"\C-f": backward-char
+$endif
+"\C-x\C-e": end-of-line
+"\C-y": yank
+`
+	cfg := &Config{}
+	err := cfg.LoadInputrc(strings.NewReader(rc))
+	if err == nil || !strings.Contains(err.Error(), "line 15") {
+		t.Fatal("error not expect", err)
+	}
+	expect := map[KeyEvent]rune{
+		{Rune: CharBackward}:               CharLineStart,
+		{Rune: 'k', Mod: ModAlt}:           CharKill,
+		{Rune: CharBackward, Mod: ModCtrl}: MetaBackward,
+		{Rune: CharLineEnd}:                CharLineEnd,
+	}
+	if len(cfg.KeyMap) != len(expect) {
+		t.Fatal("result not expect", cfg.KeyMap)
+	}
+	for k, v := range expect {
+		if cfg.KeyMap[k] != v {
+			t.Fatal("result not expect", k, cfg.KeyMap[k])
+		}
+	}
+
+	// Ctrl-B now goes to the start of the line
+	rl, _ := newTestInstance(t, strings.NewReader("bc\x02a\r"), func(c *Config) { c.KeyMap = cfg.KeyMap })
+	line, err := rl.Readline()
+	if err != nil || line != "abc" {
+		t.Fatal("result not expect", line, err)
+	}
+}
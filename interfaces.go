@@ -0,0 +1,68 @@
+package rawterm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// The interfaces below are what most programs use of an Instance, code
+// which accepts them instead of *Instance can be tested with a fake.
+
+// LineReader reads lines.
+type LineReader interface {
+	Readline() (string, error)
+	ReadlineContext(ctx context.Context) (string, error)
+	Close() error
+}
+
+// PasswordReader reads a line without echoing it.
+type PasswordReader interface {
+	ReadPassword(prompt string) ([]byte, error)
+}
+
+// Prompter changes the prompt and writes above the line being edited.
+type Prompter interface {
+	SetPrompt(prompt string)
+	Refresh()
+	Stdout() io.Writer
+	Stderr() io.Writer
+}
+
+var (
+	_ LineReader     = (*Instance)(nil)
+	_ PasswordReader = (*Instance)(nil)
+	_ Prompter       = (*Instance)(nil)
+)
+
+// NewLineReader returns a LineReader which reads the lines of r without a
+// terminal, e.g. for a script piped to a program which usually runs
+// interactively. Lines may end in \n or \r\n, the last one needs no line
+// break.
+func NewLineReader(r io.Reader) LineReader {
+	return &plainLineReader{r: bufio.NewReader(r)}
+}
+
+type plainLineReader struct {
+	r *bufio.Reader
+}
+
+func (p *plainLineReader) Readline() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+}
+
+func (p *plainLineReader) ReadlineContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return p.Readline()
+}
+
+func (p *plainLineReader) Close() error {
+	return nil
+}
@@ -0,0 +1,133 @@
+package rawterm
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Modifier is the set of modifier keys held down with a key.
+type Modifier uint8
+
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
+)
+
+// modPaste marks the runes of a bracketed paste, the paste ends with
+// KeyEvent{Mod: modPaste}.
+const modPaste Modifier = 1 << 7
+
+// KeyEvent is a decoded key press. Rune is a character, a control character
+// like CharEnter or one of the negative key constants like MetaBackward.
+// Alt chords sent as ESC followed by a key are reported as that key with
+// ModAlt, e.g. Alt+B is KeyEvent{'b', ModAlt}.
+type KeyEvent struct {
+	Rune rune
+	Mod  Modifier
+}
+
+// the Meta- keys handled by the read loop, by the key pressed with Alt
+var metaKeys = map[rune]rune{
+	'b':           MetaBackward,
+	'f':           MetaForward,
+	'd':           MetaDelete,
+	CharBackspace: MetaBackspace,
+	CharTranspose: MetaTranspose,
+}
+
+// legacyRune returns the rune the read loop handles for k. For Alt chords
+// with a Meta- key that's the Meta- constant, Ctrl+Left and Ctrl+Right move
+// by word and other keys sent as escape sequences ignore their modifiers.
+// ok is false for other chords.
+func (k KeyEvent) legacyRune() (r rune, ok bool) {
+	switch {
+	case k.Mod == 0:
+		return k.Rune, true
+	case k.Mod == ModAlt:
+		if r, ok = metaKeys[k.Rune]; ok {
+			return r, ok
+		}
+	case k.Mod&ModCtrl != 0 && k.Rune == CharBackward:
+		return MetaBackward, true
+	case k.Mod&ModCtrl != 0 && k.Rune == CharForward:
+		return MetaForward, true
+	}
+	switch k.Rune {
+	case CharBackward, CharForward, CharPrev, CharNext, CharDelete:
+		return k.Rune, true
+	}
+	return k.Rune, k.Rune < 0
+}
+
+// KeyHandler is called for a key bound with Config.Bind, it works like
+// Listener.OnChange. It runs with the line locked, so it must not call
+// SetConfig or UpdateConfig.
+type KeyHandler func(line []rune, pos int, key KeyEvent) (newLine []rune, newPos int, ok bool)
+
+// Bind makes key call h instead of its default action.
+func (c *Config) Bind(key KeyEvent, h KeyHandler) {
+	if c.KeyBindings == nil {
+		c.KeyBindings = make(map[KeyEvent]KeyHandler)
+	}
+	c.KeyBindings[key] = h
+}
+
+// AsyncKeyHandler is a KeyHandler which may be slow, e.g. a completion
+// which asks a server. ctx is canceled when the next key is pressed.
+type AsyncKeyHandler func(ctx context.Context, line []rune, pos int, key KeyEvent) (newLine []rune, newPos int, ok bool)
+
+// BindAsync makes key run h in the background, typing goes on meanwhile.
+// The line h returns is only used if it wasn't edited in the meantime.
+func (c *Config) BindAsync(key KeyEvent, h AsyncKeyHandler) {
+	if c.AsyncBindings == nil {
+		c.AsyncBindings = make(map[KeyEvent]AsyncKeyHandler)
+	}
+	c.AsyncBindings[key] = h
+}
+
+// extendedKey decodes the keys sent with Config.EnhancedKeyboard, CSI
+// code;mod u from the kitty protocol and CSI 27;mod;code ~ from
+// modifyOtherKeys.
+func extendedKey(key *escapeKeyPair) (KeyEvent, bool) {
+	sp := strings.Split(key.attr, ";")
+	var code, mod string
+	switch {
+	case key.typ == 'u' && len(sp) <= 2:
+		code = sp[0]
+		if len(sp) == 2 {
+			mod = sp[1]
+		}
+	case key.typ == '~' && len(sp) == 3 && sp[0] == "27":
+		mod, code = sp[1], sp[2]
+	default:
+		return KeyEvent{}, false
+	}
+	c, err := strconv.Atoi(code)
+	if err != nil {
+		return KeyEvent{}, false
+	}
+	m := 1
+	if mod != "" {
+		if m, err = strconv.Atoi(mod); err != nil || m < 1 {
+			return KeyEvent{}, false
+		}
+	}
+	// the parameter is 1 + the modifier bits, which use the same order as
+	// Modifier. Super and the lock keys are dropped.
+	return plainKey(KeyEvent{rune(c), Modifier(m-1) & (ModShift | ModAlt | ModCtrl)}), true
+}
+
+// plainKey turns chords which have a legacy encoding back into it, so
+// Ctrl+A is still CharLineStart and Shift+a is 'A'.
+func plainKey(k KeyEvent) KeyEvent {
+	switch {
+	case k.Mod&^ModAlt == ModCtrl && (k.Rune >= 'a' && k.Rune <= 'z' || k.Rune >= '[' && k.Rune <= '_'):
+		return KeyEvent{k.Rune & 0x1f, k.Mod &^ ModCtrl}
+	case k.Mod&^ModAlt == ModShift && IsPrintable(k.Rune):
+		return KeyEvent{unicode.ToUpper(k.Rune), k.Mod &^ ModShift}
+	}
+	return k
+}
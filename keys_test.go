@@ -0,0 +1,77 @@
+package rawterm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestModifiedKeys(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"ab cd\033[1;5Dx\r", "ab xcd"}, // Ctrl+Left moves by word
+		{"ab cd\033[1;5D\033[1;5Cx\r", "ab cdx"},
+		{"ab\033[1;2Dx\r", "axb"}, // Shift+Left is Left
+		{"ab\033[1;3D\033[3;2~\r", "a"},
+	} {
+		rl, _ := newTestInstance(t, strings.NewReader(c.in))
+		if line, err := rl.Readline(); err != nil || line != c.want {
+			t.Fatalf("%q: result not expect %q %v", c.in, line, err)
+		}
+		rl.Close()
+	}
+
+	// the modifiers reach a KeyListener
+	rec := &keyRecorder{}
+	rl, _ := newTestInstance(t, strings.NewReader("\033[1;5D\r"), WithListener(rec))
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if len(rec.keys) == 0 || rec.keys[0] != (KeyEvent{CharBackward, ModCtrl}) {
+		t.Fatal("keys not expect", rec.keys)
+	}
+}
+
+func TestEnhancedKeyboard(t *testing.T) {
+	// kitty Ctrl+Shift+A, modifyOtherKeys Ctrl+A and Ctrl+Enter
+	in := bytes.NewBufferString("bc\x1b[97;6u\x1b[27;5;97~a\x1b[13;5u\r")
+	var keys []KeyEvent
+	record := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		keys = append(keys, key)
+		return line, pos, false
+	}
+	rl, _ := newTestInstance(t, in,
+		WithKeyBinding(KeyEvent{'a', ModCtrl | ModShift}, record),
+		WithKeyBinding(KeyEvent{CharEnter, ModCtrl}, record))
+
+	line, err := rl.Readline()
+	if err != nil || line != "abc" {
+		t.Fatal("result not expect", line, err)
+	}
+	if len(keys) != 2 {
+		t.Fatal("result not expect", keys)
+	}
+}
+
+func TestNamedKeys(t *testing.T) {
+	// F5 and Ctrl+F1 are bound, Home as sent by rxvt moves to the start,
+	// PageUp has no action and must not insert anything
+	in := bytes.NewBufferString("bc\x1b[11~\x1b[1;5P\x1b[7~a\x1b[5~\x1b[15~\r")
+	var keys []KeyEvent
+	record := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		keys = append(keys, key)
+		return line, pos, false
+	}
+	rl, _ := newTestInstance(t, in,
+		WithKeyBinding(KeyEvent{KeyF5, 0}, record),
+		WithKeyBinding(KeyEvent{KeyF1, ModCtrl}, record))
+
+	line, err := rl.Readline()
+	if err != nil || line != "abc" {
+		t.Fatal("result not expect", line, err)
+	}
+	if len(keys) != 2 || keys[0].Rune != KeyF1 || keys[1].Rune != KeyF5 {
+		t.Fatal("result not expect", keys)
+	}
+}
@@ -0,0 +1,200 @@
+package rawterm
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Matcher decides whether a completion candidate matches what was typed.
+// A higher score is a better match, pos are the indexes of the runes of
+// candidate which matched, e.g. for HighlightMatch.
+type Matcher func(typed, candidate string) (score int, pos []int, ok bool)
+
+// MatchPrefix matches candidates starting with what was typed.
+func MatchPrefix(typed, candidate string) (int, []int, bool) {
+	if !strings.HasPrefix(candidate, typed) {
+		return 0, nil, false
+	}
+	return 0, prefixPos(typed), true
+}
+
+// MatchIgnoreCase is MatchPrefix ignoring case.
+func MatchIgnoreCase(typed, candidate string) (int, []int, bool) {
+	t, c := []rune(typed), []rune(candidate)
+	if len(c) < len(t) {
+		return 0, nil, false
+	}
+	for i := range t {
+		if unicode.ToLower(t[i]) != unicode.ToLower(c[i]) {
+			return 0, nil, false
+		}
+	}
+	return 0, prefixPos(typed), true
+}
+
+// MatchSmartCase is MatchIgnoreCase unless what was typed has an upper
+// case letter, then it's MatchPrefix.
+func MatchSmartCase(typed, candidate string) (int, []int, bool) {
+	if hasUpper(typed) {
+		return MatchPrefix(typed, candidate)
+	}
+	return MatchIgnoreCase(typed, candidate)
+}
+
+// MatchFuzzy matches candidates which have the runes typed in the same
+// order, with smart case. Runes in a row and at the start of words score
+// higher, gaps lower.
+func MatchFuzzy(typed, candidate string) (int, []int, bool) {
+	fold := !hasUpper(typed)
+	t, c := []rune(typed), []rune(candidate)
+	pos := make([]int, 0, len(t))
+	score := 0
+	j := 0
+	for i := 0; i < len(c) && j < len(t); i++ {
+		a, b := c[i], t[j]
+		if fold {
+			a, b = unicode.ToLower(a), unicode.ToLower(b)
+		}
+		if a != b {
+			continue
+		}
+		score += 16
+		switch {
+		case len(pos) > 0 && pos[len(pos)-1] == i-1:
+			score += 8
+		case i == 0 || strings.ContainsRune(" /_-.:", c[i-1]):
+			score += 10
+		case len(pos) > 0:
+			score -= i - pos[len(pos)-1] - 1
+		default:
+			score -= i
+		}
+		pos = append(pos, i)
+		j++
+	}
+	if j < len(t) {
+		return 0, nil, false
+	}
+	return score, pos, true
+}
+
+// MatchAll returns the candidates m matches, best first.
+func MatchAll(m Matcher, typed string, candidates []string) []string {
+	type match struct {
+		s     string
+		score int
+	}
+	var ms []match
+	for _, c := range candidates {
+		if score, _, ok := m(typed, c); ok {
+			ms = append(ms, match{c, score})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].score > ms[j].score })
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = m.s
+	}
+	return out
+}
+
+// HighlightMatch puts on and off around the runes of s at pos, e.g.
+// "\033[1m" and "\033[22m" to show what a Matcher matched in bold.
+func HighlightMatch(s string, pos []int, on, off string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	p := 0
+	for i, r := range rs {
+		hl := p < len(pos) && pos[p] == i
+		if hl && (p == 0 || pos[p-1] != i-1) {
+			b.WriteString(on)
+		}
+		b.WriteRune(r)
+		if hl {
+			p++
+			if p == len(pos) || pos[p] != i+1 {
+				b.WriteString(off)
+			}
+		}
+	}
+	return b.String()
+}
+
+func prefixPos(typed string) []int {
+	pos := make([]int, len([]rune(typed)))
+	for i := range pos {
+		pos[i] = i
+	}
+	return pos
+}
+
+func hasUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// EditDistance returns how many runes have to be inserted, deleted,
+// replaced or swapped with the next one to turn a into b, the
+// Damerau-Levenshtein distance without editing a substring twice.
+func EditDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// three rows of the table, for i-2, i-1 and i
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d := min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] && prev2[j-2]+1 < d {
+				d = prev2[j-2] + 1
+			}
+			cur[j] = d
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// Suggest returns the words at most maxDist edits away from word, closest
+// first, e.g. for a "did you mean" hint. See EditDistance.
+func Suggest(word string, words []string, maxDist int) []string {
+	type match struct {
+		s    string
+		dist int
+	}
+	var ms []match
+	for _, w := range words {
+		if d := EditDistance(word, w); d <= maxDist {
+			ms = append(ms, match{w, d})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].dist < ms[j].dist })
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = m.s
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package rawterm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Nest starts a session with cfg on the terminal of i, e.g. the REPL of a
+// debugger inside the one of an application. The prompt, line, counters
+// and keys of i are put aside until the returned Instance is closed, which
+// brings them back and leaves the terminal open. A nil cfg is a copy of
+// the config of i. The streams of i are used unless cfg has its own, Stdin
+// can't differ.
+//
+// Nest is meant to be called between reads of i, e.g. from a command it
+// runs, and i must not be used until the nested Instance is closed.
+func (i *Instance) Nest(cfg *Config) (*Instance, error) {
+	o := i.Operation
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	outer := o.cfg
+	if cfg == nil {
+		cfg = outer.Clone()
+	}
+	if cfg.Stdin == nil {
+		cfg.Stdin = outer.Stdin
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = outer.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = outer.Stderr
+	}
+	if cfg.FuncMakeRaw == nil && cfg.FuncExitRaw == nil {
+		cfg.FuncMakeRaw, cfg.FuncExitRaw = outer.FuncMakeRaw, outer.FuncExitRaw
+	}
+	if cfg.FuncIsTerminal == nil {
+		cfg.FuncIsTerminal = outer.FuncIsTerminal
+	}
+	if err := cfg.Init(); err != nil {
+		return nil, err
+	}
+	if cfg.Stdin != outer.Stdin {
+		return nil, ErrStdinChanged
+	}
+
+	s := o.nestState()
+	if _, err := o.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	o.t.SetConfig(cfg)
+
+	var once sync.Once
+	return &Instance{
+		Config:    cfg,
+		Terminal:  i.Terminal,
+		Operation: o,
+		unnest: func() {
+			once.Do(func() {
+				o.m.Lock()
+				defer o.m.Unlock()
+				o.setConfig(outer)
+				o.t.SetConfig(outer)
+				o.restoreNest(s)
+			})
+		},
+	}, nil
+}
+
+// nested is what an outer session puts aside for Nest.
+type nested struct {
+	prompt  string
+	line    []rune
+	pos     int
+	lineNo  int32
+	counter int32
+	status  string
+}
+
+// nestState takes the line and counters of the outer session, leaving an
+// empty line and fresh counters for the nested one. Called with o.m held.
+func (o *Operation) nestState() nested {
+	s := nested{
+		prompt:  o.buf.Prompt(),
+		pos:     o.buf.Pos(),
+		lineNo:  atomic.SwapInt32(&o.lineNo, 0),
+		counter: atomic.SwapInt32(&o.counter, 0),
+	}
+	s.status, _ = o.status.Load().(string)
+	s.line = o.buf.Reset()
+	o.status.Store("")
+	return s
+}
+
+func (o *Operation) restoreNest(s nested) {
+	atomic.StoreInt32(&o.lineNo, s.lineNo)
+	atomic.StoreInt32(&o.counter, s.counter)
+	o.status.Store(s.status)
+	o.buf.SetPrompt(s.prompt)
+	o.buf.Lock()
+	o.buf.buf, o.buf.idx = s.line, s.pos
+	o.buf.Unlock()
+}
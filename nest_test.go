@@ -0,0 +1,48 @@
+package rawterm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNest(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("a\rb\rc\rd\r"), WithPrompt("> "))
+	if line, err := rl.Readline(); err != nil || line != "a" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	inner, err := rl.Nest(&Config{PromptTemplate: "(dbg {n}) "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, err := inner.Readline(); err != nil || line != "b" {
+		t.Fatal("result not expect", line, err)
+	}
+	if n := inner.PromptCounter(); n != 2 || !strings.Contains(out.String(), "(dbg 1) b") {
+		t.Fatalf("nested prompt not expect %d %q", n, out.String())
+	}
+	inner.Close()
+	inner.Close()
+
+	if line, err := rl.Readline(); err != nil || line != "c" {
+		t.Fatal("result not expect", line, err)
+	}
+	s := out.String()
+	if n := rl.PromptCounter(); n != 3 || !strings.Contains(s[strings.LastIndex(s, "(dbg"):], "> c\n") {
+		t.Fatalf("outer prompt not expect %d %q", n, out.String())
+	}
+	if _, err := rl.Nest(&Config{Stdin: strings.NewReader("")}); err != ErrStdinChanged {
+		t.Fatal("error not expect", err)
+	}
+
+	// a prompt set on the outer session survives a nested one
+	rl.SetPrompt("custom$ ")
+	inner, err = rl.Nest(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.Close()
+	if line, err := rl.Readline(); err != nil || line != "d" || !strings.Contains(out.String(), "custom$ d\n") {
+		t.Fatalf("result not expect %q %v %q", line, err, out.String())
+	}
+}
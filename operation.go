@@ -1,12 +1,21 @@
 package rawterm
 
 import (
+	"context"
 	"errors"
 	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	ErrInterrupt = errors.New("Interrupt")
+
+	ErrStdinChanged = errors.New("Stdin can't be changed while running")
 )
 
 type InterruptError struct {
@@ -17,6 +26,16 @@ func (*InterruptError) Error() string {
 	return "Interrupted"
 }
 
+// eofError carries the unfinished line when Config.EOFBehavior is
+// EOFReturnPartial, Runes returns it together with io.EOF.
+type eofError struct {
+	Line []rune
+}
+
+func (*eofError) Error() string {
+	return io.EOF.Error()
+}
+
 type Operation struct {
 	cfg     *Config
 	t       *Terminal
@@ -25,6 +44,87 @@ type Operation struct {
 	errchan chan error
 	w       io.Writer
 
+	// held while a key is processed and while the config is swapped
+	m sync.Mutex
+	// protects cfg for readers outside of the read loop
+	cfgLock sync.RWMutex
+
+	abort     chan struct{}
+	done      chan struct{}
+	exited    chan struct{}
+	closeOnce sync.Once
+
+	unicode unicodeEntry
+
+	// the key handleKey is processing, so a KeyListener sees Alt+B and not
+	// the MetaBackward it was translated to
+	key KeyEvent
+
+	// typed or pasted runes not inserted yet because more input follows
+	burst    []rune
+	coalesce *time.Timer
+	// cancels the AsyncKeyHandler running for the line
+	asyncCancel context.CancelFunc
+
+	// the key for the listeners held back by ListenerDebounce, debounceGen
+	// counts the timers started so a stale one does nothing
+	debounce    *time.Timer
+	debounceKey keyPress
+	debounceGen int
+	// the burst ends with a space for a line break in a bracketed paste,
+	// pasteCR if it was a \r
+	pasteBreak, pasteCR bool
+
+	// key events from Replay and the time of the first recorded one
+	replay      chan KeyEvent
+	recordStart time.Time
+
+	// for the prompt template: the number of lines read, the editing mode
+	// and the status set by SetPromptStatus
+	lineNo int32
+	mode   atomic.Value
+	status atomic.Value
+	// {n} minus one, see PromptCounter
+	counter int32
+
+	// checks the line on Enter, set by RunesOpts
+	validate func(line string) error
+
+	// hides a character shown because of MaskRevealDelay
+	revealTimer *time.Timer
+
+	// set right after an abbreviation was expanded, and while handling the
+	// key after one was undone, which doesn't expand it again
+	abbrevUndo   *abbrevUndo
+	abbrevUndone bool
+	skipAbbrev   bool
+
+	// called with the new size after the terminal was resized
+	onResize atomic.Value
+
+	// Ctrl-D pressed on an empty line in a row, see IgnoreEOF
+	eofCount int
+
+	// the terminal height the ChatMode scroll region was set up for
+	chatHeight int32
+
+	// keys read from the terminal, see Stats
+	keys int64
+	// set once the terminal's input ended
+	inputEnded int32
+
+	idle  idleWatch
+	draft draftSaver
+	sig   signalWatch
+
+	// held between Pause and its resume, paused is set meanwhile
+	pauseLock sync.Mutex
+	paused    int32
+
+	// gets the keys instead of the line while set, see Page
+	grabLock sync.Mutex
+	grab     *keyGrab
+
 	*opPassword
 }
 
@@ -35,8 +135,13 @@ type wrapWriter struct {
 }
 
 func (w *wrapWriter) Write(b []byte) (int, error) {
-	if !w.t.IsReading() {
-		return w.target.Write(b)
+	if w.r.chatRows() > 0 {
+		return w.r.chatPrint(w.target, b)
+	}
+	if !w.t.IsReading() || atomic.LoadInt32(&w.r.paused) == 1 {
+		n, err := w.target.Write(b)
+		w.t.recordOutput(b[:n])
+		return n, err
 	}
 
 	var (
@@ -45,11 +150,24 @@ func (w *wrapWriter) Write(b []byte) (int, error) {
 	)
 	w.r.buf.Refresh(func() {
 		n, err = w.target.Write(b)
+		w.t.recordOutput(b[:n])
 	})
 
 	return n, err
 }
 
+// writeInline runs write with the line taken off the screen, see
+// Terminal.WriteInline.
+func (o *Operation) writeInline(write func()) {
+	if !o.t.IsReading() || atomic.LoadInt32(&o.paused) == 1 {
+		write()
+		return
+	}
+	// cleaned first, so LowBandwidth doesn't try to redraw only a diff
+	o.buf.Clean()
+	o.buf.Refresh(write)
+}
+
 func NewOperation(t *Terminal, cfg *Config) *Operation {
 	width := cfg.FuncGetWidth()
 	op := &Operation{
@@ -57,18 +175,59 @@ func NewOperation(t *Terminal, cfg *Config) *Operation {
 		buf:     NewRuneBuffer(t, cfg.Prompt, cfg, width),
 		outchan: make(chan []rune),
 		errchan: make(chan error),
+		abort:   make(chan struct{}),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		replay:  make(chan KeyEvent),
 	}
+	op.sig.ch = make(chan os.Signal, 1)
 	op.w = op.buf.w
 	op.SetConfig(cfg)
 	op.opPassword = newOpPassword(op)
-	op.cfg.FuncOnWidthChanged(func() {
-		newWidth := cfg.FuncGetWidth()
-		op.buf.OnWidthChange(newWidth)
-	})
+	op.unicode.o = op
+	t.m.Lock()
+	t.onScrollRegion = op.onScrollRegion
+	t.onInline = op.writeInline
+	t.m.Unlock()
+	op.buf.OnSizeChange(width, cfg.FuncGetHeight())
+	op.cfg.FuncOnWidthChanged(op.resized)
 	go op.ioloop()
 	return op
 }
 
+func (o *Operation) resized() {
+	cfg := o.config()
+	width, height := cfg.FuncGetWidth(), cfg.FuncGetHeight()
+	o.buf.OnSizeChange(width, height)
+	if o.chatRows() > 0 {
+		o.chatSetup()
+		o.buf.Redraw()
+	}
+	if f, _ := o.onResize.Load().(func(int, int)); f != nil {
+		f(width, height)
+	}
+}
+
+// OnResize makes f get called with the new size whenever the terminal is
+// resized, a height <= 0 means it's unknown.
+func (o *Operation) OnResize(f func(width, height int)) {
+	o.onResize.Store(f)
+}
+
+// Stats returns the counters since the Operation was created.
+func (o *Operation) Stats() Stats {
+	return Stats{
+		Keys:         atomic.LoadInt64(&o.keys),
+		Refreshes:    atomic.LoadInt64(&o.buf.refreshes),
+		BytesWritten: atomic.LoadInt64(&o.t.written),
+	}
+}
+
+// Size returns the terminal size as of the last resize.
+func (o *Operation) Size() (width, height int) {
+	return o.buf.Size()
+}
+
 func (o *Operation) SetBuf(s string) {
 	o.buf.WriteString(s)
 }
@@ -81,139 +240,733 @@ func (o *Operation) SetMaskRune(r rune) {
 	o.buf.SetMask(r)
 }
 
+// ended reports whether the terminal's input ended, reads after that
+// return io.EOF right away instead of waiting for keys that never come
+func (o *Operation) ended() bool {
+	return atomic.LoadInt32(&o.inputEnded) == 1
+}
+
 func (o *Operation) ioloop() {
+	defer close(o.exited)
+	in := o.t.outchan
 	for {
-		r := o.t.ReadRune()
-		if o.cfg.FuncFilterInputRune != nil {
-			var process bool
-			r, process = o.cfg.FuncFilterInputRune(r)
-			if !process {
-				o.buf.Refresh(nil) // to refresh the line
-				continue           // ignore this rune
+		var ev KeyEvent
+		typed, signaled := false, false
+		select {
+		case ch, ok := <-in:
+			if ok { // rune(0) means EOF, as in Terminal.ReadRune
+				ev = ch
+			} else {
+				// handled once as EOF, see ended
+				in = nil
+				atomic.StoreInt32(&o.inputEnded, 1)
 			}
+			typed = true
+		case sig := <-o.sig.ch:
+			if ev.Rune = signalKey(sig); ev.Rune == 0 {
+				continue
+			}
+			typed, signaled = true, true
+		case ev = <-o.replay:
+		case <-o.abort:
+			// the reader gave up on this line
+			o.m.Lock()
+			o.finishLine()
+			o.m.Unlock()
+			continue
+		case <-o.done:
+			return
 		}
-
-		if r == 0 { // io.EOF
-			if o.buf.Len() == 0 {
-				o.buf.Clean()
+		if typed {
+			atomic.AddInt64(&o.keys, 1)
+			o.idleActive()
+			if g := o.grabbed(); g != nil {
 				select {
-				case o.errchan <- io.EOF:
+				case g.keys <- ev:
+					continue
+				case <-g.stop:
+					// Page is done, the key is handled as usual
+				case <-o.done:
+					return
 				}
-				break
-			} else {
-				// if stdin got io.EOF and there is something left in buffer,
-				// let's flush them by sending CharEnter.
-				// And we will got io.EOF int next loop.
-				r = CharEnter
 			}
 		}
+		// wait while paused, see Pause
+		o.pauseLock.Lock()
+		o.pauseLock.Unlock()
+		o.m.Lock()
+		if typed {
+			o.record(ev)
+		}
+		if signaled && ev.Rune == CharCtrlZ {
+			o.sig.pause()
+		}
+		stop := o.handleKey(ev)
+		if signaled && ev.Rune == CharCtrlZ {
+			o.sig.resume()
+		}
+		o.draftChanged()
+		o.m.Unlock()
+		if stop {
+			break
+		}
+	}
+}
+
+func (o *Operation) sendLine(line []rune) {
+	select {
+	case o.outchan <- line:
+	case <-o.done:
+	}
+}
+
+func (o *Operation) sendErr(err error) {
+	select {
+	case o.errchan <- err:
+	case <-o.done:
+	}
+}
+
+// Close stops the read loop and waits for it to exit, pending and future
+// calls to Runes return io.EOF. It's safe to call Close more than once.
+func (o *Operation) Close() {
+	o.closeOnce.Do(func() {
+		o.draftFlush(o.config().Drafts, false)
+		o.chatReset()
+		close(o.done)
+		<-o.exited
+	})
+}
+
+// Closed returns a channel which is closed when Close is called.
+func (o *Operation) Closed() <-chan struct{} {
+	return o.done
+}
+
+// handleKey processes one key event, it's called with o.m held so the
+// config can't change in the middle of it. Bound keys go to their handler,
+// chords the read loop doesn't know only go to the listener.
+// It returns true once input is exhausted.
+func (o *Operation) handleKey(ev KeyEvent) bool {
+	if o.coalesce != nil {
+		o.coalesce.Stop()
+		o.coalesce = nil
+	}
+	if o.revealTimer != nil {
+		o.revealTimer.Stop()
+		o.revealTimer = nil
+		o.buf.HideReveal()
+	}
+	o.buf.SetHint("")
+	// any key but Ctrl-D starts counting the ignored ones again
+	if r, ok := o.cfg.KeyMap[ev]; ev != (KeyEvent{Rune: CharDelete}) && (!ok || r != CharDelete) {
+		o.eofCount = 0
+	}
+	if o.asyncCancel != nil {
+		o.asyncCancel()
+		o.asyncCancel = nil
+	}
+	if o.debounce != nil && finalKey(ev) {
+		// the listeners see the line as it was before it's entered
+		o.flushListeners()
+	}
+	if ev.Mod&modPaste != 0 {
+		o.paste(ev.Rune)
+		return false
+	}
+	if o.cfg.FlowControl == FlowControlTerminal &&
+		(ev == KeyEvent{Rune: CharFwdSearch} || ev == KeyEvent{Rune: CharCtrlQ}) {
+		return false
+	}
+	o.key = ev
+	defer func() { o.key = KeyEvent{} }()
+	undo := o.abbrevUndo
+	o.abbrevUndo = nil
+	o.skipAbbrev, o.abbrevUndone = o.abbrevUndone, false
+	if undo != nil && (ev == KeyEvent{Rune: CharBackspace} || ev == KeyEvent{Rune: CharCtrlH}) {
+		o.buf.SetWithIdx(undo.pos, undo.line)
+		o.abbrevUndone = true
+		return false
+	}
+	if _, bound := o.cfg.KeyBindings[ev]; bound || ev.Mod != 0 || !isBurstRune(ev.Rune) {
+		o.flushBurst()
+	}
+	if ev.Rune != 0 && o.unicode.handle(ev) {
+		return false
+	}
+	if h, ok := o.cfg.AsyncBindings[ev]; ok && ev.Rune != 0 {
+		o.startAsync(h, ev)
+		return false
+	}
+	if h, ok := o.cfg.KeyBindings[ev]; ok && ev.Rune != 0 {
+		newLine, newPos, ok := h(o.buf.Runes(), o.buf.Pos(), ev)
+		if ok {
+			o.setLine(newPos, newLine)
+		}
+		return false
+	}
+	if r, ok := o.cfg.KeyMap[ev]; ok && ev.Rune != 0 {
+		return o.handleRune(r)
+	}
+	r, ok := ev.legacyRune()
+	if !ok {
+		o.onKey(keyPress{ev: ev, r: ev.Rune, plain: ev.Mod == 0})
+		return false
+	}
+	return o.handleRune(r)
+}
+
+// bound reports whether ev has a handler or a mapping in the config.
+func (o *Operation) bound(ev KeyEvent) bool {
+	_, async := o.cfg.AsyncBindings[ev]
+	_, handler := o.cfg.KeyBindings[ev]
+	_, mapped := o.cfg.KeyMap[ev]
+	return async || handler || mapped
+}
+
+// paste collects the runes of a bracketed paste and inserts them at once
+// when r is 0. Line breaks become spaces, except one at the end which is
+// dropped, so a paste never enters the line. Other control characters but
+// tabs are dropped.
+func (o *Operation) paste(r rune) {
+	switch {
+	case r == 0:
+		if o.pasteBreak {
+			o.burst = o.burst[:len(o.burst)-1]
+		}
+		o.pasteBreak, o.pasteCR = false, false
+		o.flushBurst()
+	case r == '\n' && o.pasteCR:
+		o.pasteCR = false
+	case r == '\r' || r == '\n':
+		o.burst = append(o.burst, ' ')
+		o.pasteBreak, o.pasteCR = true, r == '\r'
+	case r == '\t' || isBurstRune(r):
+		o.burst = append(o.burst, r)
+		o.pasteBreak, o.pasteCR = false, false
+	}
+}
+
+// startAsync runs h for the current line in the background, the next key
+// cancels it.
+func (o *Operation) startAsync(h AsyncKeyHandler, ev KeyEvent) {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.asyncCancel = cancel
+	line, pos := o.buf.Runes(), o.buf.Pos()
+	hint := o.cfg.AsyncHint
+	if hint == "" {
+		hint = "…"
+	}
+	o.buf.SetHint(hint)
+	go func() {
+		newLine, newPos, ok := h(ctx, runes.Copy(line), pos, ev)
+		o.m.Lock()
+		defer o.m.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		cancel()
+		o.asyncCancel = nil
+		o.buf.SetHint("")
+		if ok && o.buf.Pos() == pos && runes.Equal(o.buf.Runes(), line) {
+			o.setLine(newPos, newLine)
+		}
+	}()
+}
+
+func isBurstRune(r rune) bool {
+	return r >= ' ' && r != CharBackspace
+}
+
+// flushBurst inserts the runes held back by handleRune.
+func (o *Operation) flushBurst() {
+	if len(o.burst) == 0 {
+		return
+	}
+	last := o.burst[len(o.burst)-1]
+	o.insert(o.burst)
+	o.burst = o.burst[:0]
+	o.onKey(keyPress{ev: KeyEvent{Rune: last}, r: last, plain: true})
+}
+
+// flushLater runs once InputCoalesceWindow passed without more input.
+func (o *Operation) flushLater() {
+	o.m.Lock()
+	defer o.m.Unlock()
+	select {
+	case <-o.done:
+		return
+	default:
+	}
+	o.coalesce = nil
+	o.flushBurst()
+}
+
+// keyPress is a key for the listeners, a KeyListener gets ev and a plain
+// Listener gets the rune r it was translated to. Alt chords without a
+// default action aren't plain.
+type keyPress struct {
+	ev    KeyEvent
+	r     rune
+	plain bool
+}
+
+// onKey tells the listeners about a key press, after ListenerDebounce
+// if it's set.
+func (o *Operation) onKey(k keyPress) {
+	if d := o.cfg.ListenerDebounce; d > 0 && !finalKey(k.ev) && len(o.cfg.listeners()) > 0 {
+		if o.debounce != nil {
+			o.debounce.Stop()
+		}
+		o.debounceGen++
+		gen := o.debounceGen
+		o.debounceKey = k
+		o.debounce = time.AfterFunc(d, func() { o.listenLater(gen) })
+		return
+	}
+	o.flushListeners()
+	o.callListeners(k)
+}
+
+// finalKey reports whether ev ends the line, the listeners get it right
+// away even with ListenerDebounce.
+func finalKey(ev KeyEvent) bool {
+	switch ev {
+	case KeyEvent{Rune: CharEnter}, KeyEvent{Rune: CharCtrlJ},
+		KeyEvent{Rune: CharInterrupt}, KeyEvent{Rune: CharDelete}:
+		return true
+	}
+	return false
+}
+
+// flushListeners calls the listeners for a key held back by
+// ListenerDebounce.
+func (o *Operation) flushListeners() {
+	if o.debounce == nil {
+		return
+	}
+	o.debounce.Stop()
+	o.debounce = nil
+	o.callListeners(o.debounceKey)
+}
+
+// listenLater runs once ListenerDebounce passed without more keys.
+func (o *Operation) listenLater(gen int) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	select {
+	case <-o.done:
+		return
+	default:
+	}
+	if gen == o.debounceGen {
+		o.flushListeners()
+	}
+}
+
+// callListeners tells the listeners about a key press, each one gets the
+// line as the one before left it.
+func (o *Operation) callListeners(k keyPress) {
+	ls := o.cfg.listeners()
+	if len(ls) == 0 {
+		return
+	}
+	line, pos := o.buf.Runes(), o.buf.Pos()
+	changed := false
+	for _, l := range ls {
+		var newLine []rune
+		var newPos int
+		var ok bool
+		switch l := l.(type) {
+		case KeyListener:
+			newLine, newPos, ok = l.OnKey(line, pos, k.ev)
+		default:
+			if !k.plain {
+				continue
+			}
+			newLine, newPos, ok = l.OnChange(line, pos, k.r)
+		}
+		if ok {
+			line, pos, changed = newLine, newPos, true
+		}
+	}
+	if changed {
+		o.setLine(pos, line)
+	}
+}
 
-		switch r {
-		case CharTab:
+// insert writes rs at the cursor, keeping the line within MaxLineLength
+// and InputPattern.
+func (o *Operation) insert(rs []rune) {
+	if p := o.cfg.InputPattern; p != nil {
+		// check each rune, a paste keeps the part that's allowed
+		line, pos := o.buf.Runes(), o.buf.Pos()
+		head, tail := line[:pos:pos], line[pos:]
+		ok := make([]rune, 0, len(rs))
+		for _, r := range rs {
+			if p.MatchString(string(head) + string(ok) + string(r) + string(tail)) {
+				ok = append(ok, r)
+			}
+		}
+		if len(ok) < len(rs) {
 			o.t.Bell()
-			break
-		case CharBckSearch:
+			defer o.buf.SetErrorHint(o.cfg.InputPatternHint)
+		}
+		rs = ok
+	}
+	if max := o.cfg.MaxLineLength; max > 0 {
+		n := fitBytes(rs, max-len(string(o.buf.Runes())))
+		if n < len(rs) {
+			if o.cfg.LengthPolicy == LengthReject {
+				n = 0
+			}
 			o.t.Bell()
-			break
-		case CharCtrlU:
-			o.buf.KillFront()
-		case CharFwdSearch:
+			for _, l := range o.cfg.listeners() {
+				if l, ok := l.(LengthListener); ok {
+					l.OnLengthLimit(o.buf.Runes(), rs[n:])
+				}
+			}
+			rs = rs[:n]
+		}
+	}
+	if len(rs) > 0 {
+		o.buf.WriteRunes(rs)
+		o.reveal()
+	}
+}
+
+// reveal shows the character just typed for MaskRevealDelay.
+func (o *Operation) reveal() {
+	d := o.cfg.MaskRevealDelay
+	if d <= 0 || !o.buf.isMasked() {
+		return
+	}
+	o.buf.Reveal(o.buf.Pos() - 1)
+	o.revealTimer = time.AfterFunc(d, o.buf.HideReveal)
+}
+
+// setLine replaces the line with one returned by a listener or a key
+// handler, which is cut at MaxLineLength.
+func (o *Operation) setLine(pos int, line []rune) {
+	if max := o.cfg.MaxLineLength; max > 0 {
+		line = line[:fitBytes(line, max)]
+		if pos > len(line) {
+			pos = len(line)
+		}
+	}
+	o.buf.SetWithIdx(pos, line)
+}
+
+// fitBytes returns how many runes of rs fit into n bytes of UTF-8.
+func fitBytes(rs []rune, n int) int {
+	for i, r := range rs {
+		n -= utf8.RuneLen(r)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(rs)
+}
+
+// handleRune processes one key without modifiers.
+func (o *Operation) handleRune(r rune) bool {
+	if o.cfg.FuncFilterInputRune != nil {
+		var process bool
+		r, process = o.cfg.FuncFilterInputRune(r)
+		if !process {
+			o.buf.Refresh(nil) // to refresh the line
+			return false       // ignore this rune
+		}
+	}
+	if !isBurstRune(r) {
+		o.flushBurst()
+	}
+	if sig := keySignal(r); sig != nil && o.cfg.FuncOnSignal != nil && o.cfg.FuncOnSignal(sig) {
+		o.t.KickRead()
+		return false
+	}
+
+	if r == 0 { // io.EOF
+		if o.buf.Len() == 0 {
+			o.buf.Clean()
+			o.sendErr(io.EOF)
+			return true
+		}
+		switch o.cfg.EOFBehavior {
+		case EOFDiscard:
+			o.buf.Clean()
+			o.buf.Reset()
+			o.sendErr(io.EOF)
+			return true
+		case EOFReturnPartial:
+			o.sendErr(&eofError{o.finishLine()})
+			return true
+		default:
+			// if stdin got io.EOF and there is something left in buffer,
+			// let's flush them by sending CharEnter.
+			// And we will got io.EOF int next loop.
+			r = CharEnter
+		}
+	}
+
+	switch r {
+	case CharTab:
+		o.t.Bell()
+		break
+	case CharBckSearch:
+		o.t.Bell()
+		break
+	case CharCtrlU:
+		o.buf.KillFront()
+	case CharFwdSearch:
+		o.t.Bell()
+		break
+	case CharKill:
+		o.buf.Kill()
+	case MetaForward:
+		o.buf.MoveToNextWord()
+	case CharTranspose:
+		o.buf.Transpose()
+	case MetaBackward:
+		o.buf.MoveToPrevWord()
+	case MetaDelete:
+		o.buf.DeleteWord()
+	case CharLineStart, KeyHome:
+		o.buf.MoveToLineStart()
+	case CharLineEnd, KeyEnd:
+		o.buf.MoveToLineEnd()
+	case CharBackspace, CharCtrlH:
+		if o.buf.Len() == 0 {
 			o.t.Bell()
 			break
-		case CharKill:
-			o.buf.Kill()
-		case MetaForward:
-			o.buf.MoveToNextWord()
-		case CharTranspose:
-			o.buf.Transpose()
-		case MetaBackward:
-			o.buf.MoveToPrevWord()
-		case MetaDelete:
-			o.buf.DeleteWord()
-		case CharLineStart:
-			o.buf.MoveToLineStart()
-		case CharLineEnd:
-			o.buf.MoveToLineEnd()
-		case CharBackspace, CharCtrlH:
-			if o.buf.Len() == 0 {
+		}
+		o.buf.Backspace()
+	case CharCtrlZ:
+		o.buf.Clean()
+		o.t.SleepToResume()
+		o.Refresh()
+	case CharCtrlL:
+		ClearScreen(o.w)
+		o.Refresh()
+	case MetaBackspace, CharCtrlW:
+		o.buf.BackEscapeWord()
+	case CharEnter, CharCtrlJ:
+		o.expandAbbrev(false)
+		if o.validate != nil {
+			if err := o.validate(string(o.buf.Runes())); err != nil {
 				o.t.Bell()
-				break
-			}
-			o.buf.Backspace()
-		case CharCtrlZ:
-			o.buf.Clean()
-			o.t.SleepToResume()
-			o.Refresh()
-		case CharCtrlL:
-			ClearScreen(o.w)
-			o.Refresh()
-		case MetaBackspace, CharCtrlW:
-			o.buf.BackEscapeWord()
-		case CharEnter, CharCtrlJ:
-			o.buf.MoveToLineEnd()
-			var data []rune
-			if !o.cfg.UniqueEditLine {
-				o.buf.WriteRune('\n')
-				data = o.buf.Reset()
-				data = data[:len(data)-1] // trim \n
-			} else {
-				o.buf.Clean()
-				data = o.buf.Reset()
-			}
-			o.outchan <- data
-		case CharBackward:
-			o.buf.MoveBackward()
-		case CharForward:
-			o.buf.MoveForward()
-		case CharDelete:
-			if o.buf.Len() > 0 {
+				o.buf.SetErrorHint(err.Error())
 				o.t.KickRead()
-				if !o.buf.Delete() {
-					o.t.Bell()
-				}
 				break
 			}
-
-			// treat as EOF
-			if !o.cfg.UniqueEditLine {
-				o.buf.WriteString(o.cfg.EOFPrompt + "\n")
-			}
-			o.buf.Reset()
-			o.errchan <- io.EOF
-			if o.cfg.UniqueEditLine {
-				o.buf.Clean()
-			}
-		case CharInterrupt:
-			o.buf.MoveToLineEnd()
-			o.buf.Refresh(nil)
-			hint := o.cfg.InterruptPrompt + "\n"
-			if !o.cfg.UniqueEditLine {
-				o.buf.WriteString(hint)
-			}
-			remain := o.buf.Reset()
-			if !o.cfg.UniqueEditLine {
-				remain = remain[:len(remain)-len([]rune(hint))]
+		}
+		line := o.finishLine()
+		if o.cfg.ExpandOnAccept {
+			line = []rune(ExpandLine(string(line)))
+		}
+		if len(line) > 0 {
+			atomic.AddInt32(&o.counter, 1)
+		}
+		o.sendLine(line)
+	case CharBackward:
+		o.buf.MoveBackward()
+	case CharForward:
+		o.buf.MoveForward()
+	case CharDelete:
+		if o.buf.Len() > 0 {
+			o.eofCount = 0
+			o.t.KickRead()
+			if !o.buf.Delete() {
+				o.t.Bell()
 			}
-			o.errchan <- &InterruptError{remain}
-		default:
-			o.buf.WriteRune(r)
+			break
+		}
+		if o.eofCount < o.cfg.IgnoreEOF {
+			o.eofCount++
+			o.restartLine(o.cfg.EOFPrompt)
+			break
+		}
+		o.eofCount = 0
+		if !o.confirmExit(io.EOF) {
+			o.t.KickRead()
+			break
 		}
 
-		if o.cfg.Listener != nil {
-			newLine, newPos, ok := o.cfg.Listener.OnChange(o.buf.Runes(), o.buf.Pos(), r)
-			if ok {
-				o.buf.SetWithIdx(newPos, newLine)
-			}
+		// treat as EOF
+		if !o.cfg.UniqueEditLine {
+			o.buf.WriteString(o.cfg.EOFPrompt + "\n")
+		}
+		o.buf.Reset()
+		o.sendErr(io.EOF)
+		if o.cfg.UniqueEditLine {
+			o.buf.Clean()
+		}
+	case CharEsc:
+		// a bare ESC after EscSequenceTimeout, only for the listener
+	case CharInterrupt:
+		if o.cfg.InterruptBehavior == InterruptForward {
+			o.t.KickRead()
+			break
+		}
+		if o.cfg.InterruptBehavior == InterruptClearLine {
+			o.restartLine(o.cfg.InterruptPrompt)
+			break
+		}
+		if !o.confirmExit(ErrInterrupt) {
+			o.t.KickRead()
+			break
+		}
+		o.buf.MoveToLineEnd()
+		o.buf.Refresh(nil)
+		hint := o.cfg.InterruptPrompt + "\n"
+		if !o.cfg.UniqueEditLine {
+			o.buf.WriteString(hint)
+		}
+		remain := o.buf.Reset()
+		if !o.cfg.UniqueEditLine {
+			remain = remain[:len(remain)-len([]rune(hint))]
+		}
+		o.sendErr(&InterruptError{remain})
+	default:
+		if r < 0 {
+			break // a named key without a default action
+		}
+		if !isBurstRune(r) {
+			o.insert([]rune{r})
+			break
+		}
+		if r == ' ' && !o.t.hasPendingInput() && o.expandAbbrev(true) {
+			break
+		}
+		// the rest of a paste or of an IME composition is already queued
+		// or about to arrive, insert all of it at once and let the
+		// listener see it with the last rune.
+		o.burst = append(o.burst, r)
+		if o.t.hasPendingInput() {
+			return false
+		}
+		if d := o.cfg.InputCoalesceWindow; d > 0 {
+			o.coalesce = time.AfterFunc(d, o.flushLater)
+			return false
 		}
+		o.flushBurst()
+		return false
+	}
+
+	ev := KeyEvent{Rune: r}
+	if o.key.Mod != 0 {
+		ev = o.key
+	}
+	o.onKey(keyPress{ev: ev, r: r, plain: true})
+	return false
+}
+
+// confirmExit asks Config.FuncConfirmExit whether the read may end with
+// reason.
+func (o *Operation) confirmExit(reason error) bool {
+	if o.cfg.FuncConfirmExit == nil {
+		return true
 	}
+	return o.cfg.FuncConfirmExit(reason)
+}
+
+// Confirm shows question in place of the prompt and line, which come back
+// afterwards, and reports whether the next key is y. It reads the key
+// itself, so it's only meant for Config.FuncConfirmExit and key handlers.
+// If the input ended it returns true, if the Operation is closed false.
+func (o *Operation) Confirm(question string) bool {
+	o.buf.Clean()
+	o.t.Write([]byte(question))
+	o.t.KickRead()
+	var ev KeyEvent
+	var ok bool
+	select {
+	case ev, ok = <-o.t.outchan:
+	case <-o.done:
+		return false
+	}
+	o.t.Write([]byte("\r\033[K"))
+	o.buf.Refresh(nil)
+	return !ok || ev == KeyEvent{Rune: 'y'} || ev == KeyEvent{Rune: 'Y'}
+}
+
+// fixMissingNewline moves to a new line if the cursor isn't at the start of
+// one, the way zsh does without asking the terminal: the marker and padding
+// fill exactly the rest of the row when it's at the start, and wrap to the
+// next one otherwise. Either way "\r" then lands on an empty row.
+func (o *Operation) fixMissingNewline() {
+	cfg := o.config()
+	width := cfg.FuncGetWidth()
+	if !cfg.FixMissingNewline || o.chatRows() > 0 || width <= 0 {
+		return
+	}
+	marker := cfg.MissingNewlineMarker
+	if marker == "" {
+		marker = " "
+	}
+	pad := width - runes.WidthAll([]rune(marker))
+	if pad < 0 {
+		marker, pad = " ", width-1
+	}
+	io.WriteString(o.t, marker+strings.Repeat(" ", pad)+"\r\033[K")
+}
+
+// restartLine drops the line and shows the prompt again on the next row,
+// below the dropped line followed by hint.
+func (o *Operation) restartLine(hint string) {
+	o.flushBurst()
+	o.unicode.reset()
+	if o.cfg.UniqueEditLine {
+		o.buf.Set(nil)
+	} else {
+		o.buf.MoveToLineEnd()
+		o.buf.WriteString(hint + "\n")
+		o.buf.Reset()
+		o.buf.Refresh(nil)
+	}
+	o.t.KickRead()
+}
+
+// config returns the current config, for use outside of the read loop.
+func (o *Operation) config() *Config {
+	o.cfgLock.RLock()
+	cfg := o.cfg
+	o.cfgLock.RUnlock()
+	return cfg
+}
+
+// finishLine moves past the current line and returns its content, leaving
+// the buffer empty for the next one.
+func (o *Operation) finishLine() []rune {
+	if o.asyncCancel != nil {
+		o.asyncCancel()
+		o.asyncCancel = nil
+	}
+	o.flushBurst()
+	o.unicode.reset()
+	o.abbrevUndo, o.abbrevUndone, o.skipAbbrev = nil, false, false
+	atomic.AddInt32(&o.lineNo, 1)
+	o.buf.MoveToLineEnd()
+	o.draftFlush(o.cfg.Drafts, true)
+	var data []rune
+	if !o.cfg.UniqueEditLine {
+		o.buf.WriteRune('\n')
+		data = o.buf.Reset()
+		data = data[:len(data)-1] // trim \n
+	} else {
+		o.buf.Clean()
+		data = o.buf.Reset()
+		o.chatEcho(data)
+	}
+	return data
 }
 
 func (o *Operation) Stderr() io.Writer {
-	return &wrapWriter{target: o.cfg.Stderr, r: o, t: o.t}
+	return &wrapWriter{target: o.config().Stderr, r: o, t: o.t}
 }
 
 func (o *Operation) Stdout() io.Writer {
-	return &wrapWriter{target: o.cfg.Stdout, r: o, t: o.t}
+	return &wrapWriter{target: o.config().Stdout, r: o, t: o.t}
 }
 
 func (o *Operation) String() (string, error) {
@@ -222,24 +975,108 @@ func (o *Operation) String() (string, error) {
 }
 
 func (o *Operation) Runes() ([]rune, error) {
+	return o.RunesContext(context.Background())
+}
+
+// RunesContext is Runes which gives up when ctx is done, the unfinished line
+// is dropped and ctx.Err() returned.
+func (o *Operation) RunesContext(ctx context.Context) ([]rune, error) {
+	select {
+	case <-o.done:
+		return nil, io.EOF
+	default:
+	}
+
+	if o.ended() {
+		return nil, io.EOF
+	}
+
 	o.t.EnterRawMode()
 	defer o.t.ExitRawMode()
+	o.idleStart()
+	defer o.idleStop()
+	if o.config().KernelSignals {
+		o.sig.start()
+		defer o.sig.stop()
+	}
 
-	if o.cfg.Listener != nil {
-		o.cfg.Listener.OnChange(nil, 0, 0)
+	for _, l := range o.config().listeners() {
+		l.OnChange(nil, 0, 0)
 	}
 
+	o.chatSetup()
+	o.fixMissingNewline()
+	o.draftRestore()
+	if o.config().BracketedPaste {
+		o.t.Write([]byte("\033[?2004h"))
+		defer o.t.Write([]byte("\033[?2004l"))
+	}
 	o.buf.Refresh(nil) // print prompt
 	o.t.KickRead()
 	select {
 	case r := <-o.outchan:
 		return r, nil
 	case err := <-o.errchan:
-		if e, ok := err.(*InterruptError); ok {
-			return e.Line, ErrInterrupt
-		}
-		return nil, err
+		return o.result(err)
+	case <-o.done:
+		return nil, io.EOF
+	case <-ctx.Done():
 	}
+
+	o.t.CancelRead()
+	select {
+	case o.abort <- struct{}{}:
+	// the line may have been finished in the meantime
+	case r := <-o.outchan:
+		return r, nil
+	case err := <-o.errchan:
+		return o.result(err)
+	case <-o.done:
+		return nil, io.EOF
+	}
+	return nil, ctx.Err()
+}
+
+// RunesOpts is RunesContext with options which only apply to this line,
+// the prompt and mask are restored afterwards.
+func (o *Operation) RunesOpts(ctx context.Context, opts ...ReadOption) ([]rune, error) {
+	var ro readOptions
+	for _, opt := range opts {
+		opt(&ro)
+	}
+
+	o.m.Lock()
+	oldPrompt := o.buf.Prompt()
+	if ro.prompt != nil {
+		o.buf.SetPrompt(*ro.prompt)
+	}
+	if ro.mask != nil {
+		wasOn, oldMask := o.buf.setMaskOn(true, *ro.mask)
+		defer o.buf.setMaskOn(wasOn, oldMask)
+	}
+	o.validate = ro.validate
+	if ro.initial != "" {
+		o.buf.Set([]rune(ro.initial))
+	}
+	o.m.Unlock()
+
+	defer func() {
+		o.m.Lock()
+		o.buf.SetPrompt(oldPrompt)
+		o.validate = nil
+		o.m.Unlock()
+	}()
+	return o.RunesContext(ctx)
+}
+
+func (o *Operation) result(err error) ([]rune, error) {
+	switch e := err.(type) {
+	case *InterruptError:
+		return e.Line, ErrInterrupt
+	case *eofError:
+		return e.Line, io.EOF
+	}
+	return nil, err
 }
 
 func (o *Operation) PasswordEx(prompt string, l Listener) ([]byte, error) {
@@ -258,7 +1095,16 @@ func (o *Operation) PasswordWithConfig(cfg *Config) ([]byte, error) {
 		return nil, err
 	}
 	defer o.opPassword.ExitPasswordMode()
-	return o.Slice()
+	r, err := o.Runes()
+	if err != nil {
+		return nil, err
+	}
+	b := appendRunes(make([]byte, 0, len(r)), r)
+	// don't leave a copy of the password around
+	for i := range r {
+		r[i] = 0
+	}
+	return b, nil
 }
 
 func (o *Operation) Password(prompt string) ([]byte, error) {
@@ -274,10 +1120,51 @@ func (o *Operation) Slice() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(string(r)), nil
+	return appendRunes(make([]byte, 0, len(r)), r), nil
+}
+
+// AppendLine reads a line and appends it to dst, so a caller reading many
+// lines can reuse one buffer. Only reading the line allocates, appending
+// it doesn't if dst has room.
+func (o *Operation) AppendLine(dst []byte) ([]byte, error) {
+	r, err := o.Runes()
+	if err != nil {
+		return dst, err
+	}
+	return appendRunes(dst, r), nil
+}
+
+// ReadRunesInto reads a line into buf and returns its length. A line which
+// doesn't fit is cut off and io.ErrShortBuffer returned.
+func (o *Operation) ReadRunesInto(buf []rune) (int, error) {
+	r, err := o.Runes()
+	if err != nil {
+		return 0, err
+	}
+	n := copy(buf, r)
+	if n < len(r) {
+		return n, io.ErrShortBuffer
+	}
+	return n, nil
+}
+
+// appendRunes appends rs to dst as UTF-8.
+func appendRunes(dst []byte, rs []rune) []byte {
+	var b [utf8.UTFMax]byte
+	for _, r := range rs {
+		n := utf8.EncodeRune(b[:], r)
+		dst = append(dst, b[:n]...)
+	}
+	return dst
 }
 
 func (op *Operation) SetConfig(cfg *Config) (*Config, error) {
+	op.m.Lock()
+	defer op.m.Unlock()
+	return op.setConfig(cfg)
+}
+
+func (op *Operation) setConfig(cfg *Config) (*Config, error) {
 	if op.cfg == cfg {
 		return op.cfg, nil
 	}
@@ -285,24 +1172,95 @@ func (op *Operation) SetConfig(cfg *Config) (*Config, error) {
 		return op.cfg, err
 	}
 	old := op.cfg
+	op.cfgLock.Lock()
 	op.cfg = cfg
+	op.cfgLock.Unlock()
 	op.SetPrompt(cfg.Prompt)
+	if cfg.PromptTemplate != "" {
+		op.buf.SetPromptFunc(op.expandPrompt)
+	} else {
+		op.buf.SetPromptFunc(nil)
+	}
 	op.SetMaskRune(cfg.MaskRune)
 	op.buf.SetConfig(cfg)
 
 	return old, nil
 }
 
+// UpdateConfig calls f with a copy of the current config and switches to it
+// between two key events, re-rendering the line with the new settings.
+func (o *Operation) UpdateConfig(f func(*Config)) (*Config, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	cfg := o.cfg.Clone()
+	f(cfg)
+	if err := cfg.Init(); err != nil {
+		return nil, err
+	}
+	if cfg.Stdin != o.cfg.Stdin {
+		return nil, ErrStdinChanged
+	}
+	if _, err := o.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	o.t.SetConfig(cfg)
+	o.buf.OnSizeChange(cfg.FuncGetWidth(), cfg.FuncGetHeight())
+	o.Refresh()
+	return cfg, nil
+}
+
 func (o *Operation) Refresh() {
-	if o.t.IsReading() {
+	if o.t.IsReading() && atomic.LoadInt32(&o.paused) == 0 {
 		o.buf.Refresh(nil)
 	}
 }
 
+// ForceRedraw repaints the prompt and line from scratch, e.g. after
+// something else wrote to the terminal. It's safe to call from any
+// goroutine, like one handling signals.
+func (o *Operation) ForceRedraw() {
+	if o.t.IsReading() && atomic.LoadInt32(&o.paused) == 0 {
+		o.buf.Redraw()
+	}
+}
+
 func (o *Operation) Clean() {
 	o.buf.Clean()
 }
 
+// Pause removes the prompt and line from the screen and leaves raw mode, so
+// the program can write anything or run another UI. Keys are not handled
+// until the returned resume is called, which enters raw mode again and
+// redraws the prompt and line as they were, cursor included.
+func (o *Operation) Pause() (resume func()) {
+	o.pauseLock.Lock()
+	o.m.Lock()
+	reading := o.t.IsReading()
+	if reading {
+		o.buf.Clean()
+		o.t.CancelRead()
+	}
+	o.t.pauseRaw()
+	atomic.StoreInt32(&o.paused, 1)
+	o.m.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			o.m.Lock()
+			atomic.StoreInt32(&o.paused, 0)
+			o.t.resumeRaw()
+			if reading {
+				o.buf.Refresh(nil)
+				o.t.KickRead()
+			}
+			o.m.Unlock()
+			o.pauseLock.Unlock()
+		})
+	}
+}
+
 func FuncListener(f func(line []rune, pos int, key rune) (newLine []rune, newPos int, ok bool)) Listener {
 	return &DumpListener{f: f}
 }
@@ -318,3 +1276,20 @@ func (d *DumpListener) OnChange(line []rune, pos int, key rune) (newLine []rune,
 type Listener interface {
 	OnChange(line []rune, pos int, key rune) (newLine []rune, newPos int, ok bool)
 }
+
+// LengthListener is a Listener which is told about input dropped because
+// the line reached Config.MaxLineLength.
+type LengthListener interface {
+	Listener
+	OnLengthLimit(line []rune, dropped []rune)
+}
+
+// KeyListener is a Listener which also gets the modifiers of each key,
+// OnKey is called instead of OnChange. Alt chords without a default action
+// are only delivered to a KeyListener. Chords with a default action are
+// reported as pressed, e.g. Alt+B is KeyEvent{'b', ModAlt} and not
+// MetaBackward, named keys like KeyF1 have their own constants.
+type KeyListener interface {
+	Listener
+	OnKey(line []rune, pos int, key KeyEvent) (newLine []rune, newPos int, ok bool)
+}
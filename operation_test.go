@@ -0,0 +1,669 @@
+package rawterm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	rl, _ := newTestInstance(t, strings.NewReader(""))
+
+	err := rl.UpdateConfig(func(c *Config) {
+		c.Prompt = "new> "
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.Config.Prompt != "new> " {
+		t.Fatal("result not expect", rl.Config.Prompt)
+	}
+
+	err = rl.UpdateConfig(func(c *Config) {
+		c.Stdin = bytes.NewBuffer(nil)
+	})
+	if err != ErrStdinChanged {
+		t.Fatal("result not expect", err)
+	}
+}
+
+func TestEOFBehavior(t *testing.T) {
+	tests := []struct {
+		behavior EOFBehavior
+		line     string
+		err      error
+	}{
+		{EOFSubmit, "partial", nil},
+		{EOFDiscard, "", io.EOF},
+		{EOFReturnPartial, "partial", io.EOF},
+	}
+	for _, test := range tests {
+		rl, _ := newTestInstance(t, strings.NewReader("partial"), func(c *Config) {
+			c.EOFBehavior = test.behavior
+		})
+		line, err := rl.Readline()
+		if line != test.line || err != test.err {
+			t.Fatal("result not expect", test.behavior, line, err)
+		}
+		rl.Close()
+	}
+}
+
+func TestEOFSubmitUpdateConfig(t *testing.T) {
+	rl, _ := newTestInstance(t, strings.NewReader("partial"))
+	if line, err := rl.Readline(); err != nil || line != "partial" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	// the end of input must not hold the lock until the next read
+	done := make(chan error, 1)
+	go func() {
+		if _, err := rl.Operation.UpdateConfig(func(c *Config) { c.Prompt = "> " }); err != nil {
+			done <- err
+			return
+		}
+		_, err := rl.Readline()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatal("result not expect", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlock after the end of input")
+	}
+}
+
+func TestInterruptBehavior(t *testing.T) {
+	tests := []struct {
+		behavior InterruptBehavior
+		line     string
+		err      error
+	}{
+		{InterruptAbort, "abc", ErrInterrupt},
+		{InterruptClearLine, "def", nil},
+		{InterruptForward, "abcdef", nil},
+	}
+	for _, test := range tests {
+		r, w := io.Pipe()
+		rl, _ := newTestInstance(t, r, WithInterruptBehavior(test.behavior))
+		go w.Write([]byte("abc\x03def\r"))
+		line, err := rl.Readline()
+		if line != test.line || err != test.err {
+			t.Fatal("result not expect", test.behavior, line, err)
+		}
+		rl.Close()
+		w.Close()
+	}
+}
+
+func TestIgnoreEOF(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, out := newTestInstance(t, r, WithIgnoreEOF(2, "use exit"))
+
+	// a key in between starts counting again
+	go w.Write([]byte("\x04\x04a\x7f\x04\x04\x04"))
+	if _, err := rl.Readline(); err != io.EOF {
+		t.Fatal("error not expect", err)
+	}
+	// the last one is shown with the EOF
+	if n := strings.Count(out.String(), "use exit\n"); n != 5 {
+		t.Fatal("hint not shown 5 times", n)
+	}
+
+	// so does a bound key or Ctrl-D deleting a character
+	insert := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		return []rune("a"), 0, true
+	}
+	rl, _ = newTestInstance(t, strings.NewReader("\x04\x14\x04\x04x\r"),
+		WithIgnoreEOF(1, "use exit"), WithKeyBinding(KeyEvent{Rune: CharTranspose}, insert))
+	if line, err := rl.Readline(); err != nil || line != "x" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestConfirmExit(t *testing.T) {
+	var reasons []error
+	var rl *Instance
+	rl, out := newTestInstance(t, strings.NewReader("\x04nab\x03n\r\x04y"), func(c *Config) {
+		c.FuncConfirmExit = func(reason error) bool {
+			reasons = append(reasons, reason)
+			return rl.Confirm("really quit? [y/n] ")
+		}
+	})
+
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	if _, err := rl.Readline(); err != io.EOF {
+		t.Fatal("error not expect", err)
+	}
+	if !reflect.DeepEqual(reasons, []error{io.EOF, ErrInterrupt, io.EOF}) {
+		t.Fatal("reasons not expect", reasons)
+	}
+	if n := strings.Count(out.String(), "really quit? [y/n] "); n != 3 {
+		t.Fatal("question not shown 3 times", n)
+	}
+}
+
+func TestConfirmClose(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	asked := make(chan struct{})
+	var rl *Instance
+	rl, _ = newTestInstance(t, r, func(c *Config) {
+		c.FuncConfirmExit = func(reason error) bool {
+			close(asked)
+			return rl.Confirm("really quit? [y/n] ")
+		}
+	})
+
+	go w.Write([]byte{CharDelete})
+	go rl.Readline()
+	<-asked
+	closed := make(chan struct{})
+	go func() {
+		rl.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked by Confirm")
+	}
+}
+
+func TestOnSignal(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	var sigs []os.Signal
+	rl, _ := newTestInstance(t, r, func(c *Config) {
+		c.FuncOnSignal = func(sig os.Signal) bool {
+			sigs = append(sigs, sig)
+			return true
+		}
+	})
+
+	go w.Write([]byte("a\x03b\r"))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	if len(sigs) != 1 || sigs[0] != keySignal(CharInterrupt) {
+		t.Fatal("signals not expect", sigs)
+	}
+}
+
+func TestKernelSignals(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	typed := make(chan struct{}, 1)
+	rl, _ := newTestInstance(t, r, func(c *Config) {
+		c.KernelSignals = true
+		c.Listener = FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			if key == 'b' {
+				typed <- struct{}{}
+			}
+			return nil, 0, false
+		})
+	})
+
+	go func() {
+		w.Write([]byte("ab"))
+		<-typed
+		p, _ := os.FindProcess(os.Getpid())
+		if err := p.Signal(keySignal(CharInterrupt)); err != nil {
+			w.Write([]byte{CharInterrupt}) // can't signal itself, e.g. on Windows
+		}
+	}()
+	if line, err := rl.Readline(); err != ErrInterrupt || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	for _, f := range []FlowControl{FlowControlKeys, FlowControlTerminal} {
+		r, w := io.Pipe()
+		rl, _ := newTestInstance(t, r, WithFlowControl(f), func(c *Config) {
+			c.Bind(KeyEvent{Rune: CharCtrlQ}, func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+				return append(line, 'q'), pos + 1, true
+			})
+		})
+		go w.Write([]byte("a\x11\x13b\r"))
+		want := map[FlowControl]string{FlowControlKeys: "aqb", FlowControlTerminal: "ab"}[f]
+		if line, err := rl.Readline(); err != nil || line != want {
+			t.Fatal("result not expect", f, line, err)
+		}
+		rl.Close()
+		w.Close()
+	}
+}
+
+func TestFuncBell(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	bells := 0
+	rl, out := newTestInstance(t, r, func(c *Config) {
+		c.FuncBell = func() { bells++ }
+	})
+
+	go w.Write([]byte("\x7fa\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "a" {
+		t.Fatal("result not expect", line, err)
+	}
+	if bells != 2 || strings.ContainsRune(out.String(), CharBell) {
+		t.Fatal("bell not expect", bells, strconv.Quote(out.String()))
+	}
+}
+
+func TestPause(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	typed := make(chan struct{}, 1)
+	rl, out := newTestInstance(t, r, func(c *Config) {
+		c.Prompt = "> "
+		c.FuncIsTerminal = func() bool { return true }
+		c.Listener = FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			if key == 'b' {
+				typed <- struct{}{}
+			}
+			return nil, 0, false
+		})
+	})
+
+	go func() {
+		w.Write([]byte("ab"))
+		<-typed
+		resume := rl.Pause()
+		w.Write([]byte("c")) // handled after resume
+		rl.Write([]byte("output\n"))
+		resume()
+		resume()
+		w.Write([]byte("\r"))
+	}()
+	if line, err := rl.Readline(); err != nil || line != "abc" {
+		t.Fatal("result not expect", line, err)
+	}
+	s := out.String()
+	if i := strings.Index(s, "output\n"); i < 0 || strings.Contains(s[:i], "> abc") ||
+		!strings.Contains(s[i:], "> ab") {
+		t.Fatal("line not redrawn after output", strconv.Quote(s))
+	}
+}
+
+func TestListenerChain(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	upper := FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		return []rune(strings.ToUpper(string(line))), pos, true
+	})
+	var seen string
+	watch := FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		if key == 'b' {
+			seen = string(line)
+		}
+		return nil, 0, false
+	})
+	rl, _ := newTestInstance(t, r, WithListeners(upper, watch))
+
+	go w.Write([]byte("a"))
+	time.Sleep(10 * time.Millisecond)
+	go w.Write([]byte("b\r"))
+	if line, err := rl.Readline(); err != nil || line != "AB" {
+		t.Fatal("result not expect", line, err)
+	}
+	if seen != "AB" {
+		t.Fatal("later listener didn't see the change", seen)
+	}
+}
+
+func TestListenerDebounce(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	var m sync.Mutex
+	var seen []string
+	rl, _ := newTestInstance(t, r, WithListenerFunc(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		if key != 0 {
+			m.Lock()
+			seen = append(seen, string(line))
+			m.Unlock()
+		}
+		return nil, 0, false
+	}), func(c *Config) { c.ListenerDebounce = 30 * time.Millisecond })
+
+	go func() {
+		w.Write([]byte("a"))
+		w.Write([]byte("b"))
+		time.Sleep(60 * time.Millisecond)
+		w.Write([]byte("c"))
+		w.Write([]byte("\r"))
+	}()
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	// ab after the pause, abc right before Enter, then Enter itself
+	if !reflect.DeepEqual(seen, []string{"ab", "abc", ""}) {
+		t.Fatalf("listener calls not expect: %q", seen)
+	}
+}
+
+func TestBindAsync(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	rl, out := newTestInstance(t, r, func(c *Config) {
+		c.BindAsync(KeyEvent{Rune: CharTab}, func(ctx context.Context, line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+			select {
+			case <-release:
+				return []rune("hello"), 5, true
+			case <-ctx.Done():
+				close(canceled)
+				return nil, 0, false
+			}
+		})
+	})
+
+	go func() {
+		// the first completion is canceled by typing on
+		w.Write([]byte("h\t"))
+		time.Sleep(10 * time.Millisecond)
+		if !strings.Contains(out.String(), "…") {
+			t.Error("placeholder not shown")
+		}
+		w.Write([]byte("e"))
+		<-canceled
+		w.Write([]byte("\t"))
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("!\r"))
+	}()
+	if line, err := rl.Readline(); err != nil || line != "hello!" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestKeyListener(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rec := &keyRecorder{}
+	rl, _ := newTestInstance(t, r, WithListener(rec))
+
+	go w.Write([]byte("a b\033b\033OP\r"))
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	want := []KeyEvent{{'b', ModAlt}, {KeyF1, 0}}
+	var got []KeyEvent
+	rec.Lock()
+	defer rec.Unlock()
+	for _, k := range rec.keys {
+		if k.Mod != 0 || k.Rune == KeyF1 {
+			got = append(got, k)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("keys not expect", rec.keys)
+	}
+}
+
+func TestListenerAltChord(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	var mu sync.Mutex
+	var keys []rune
+	rl, _ := newTestInstance(t, r, WithListenerFunc(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		return nil, 0, false
+	}))
+
+	go func() {
+		for _, k := range []string{"b", "\033b", "\033x", "c", "\r"} {
+			w.Write([]byte(k))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// 0 starts the read, Alt+B is seen as MetaBackward and Alt+X has no
+	// default action
+	want := []rune{0, 'b', MetaBackward, 'c', CharEnter}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatal("keys not expect", keys)
+	}
+}
+
+func TestStats(t *testing.T) {
+	rl, _ := newTestInstance(t, strings.NewReader("abc\r"))
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	s := rl.Stats()
+	if s.Keys != 4 || s.Refreshes == 0 || s.BytesWritten == 0 || s.BytesPerKey() == 0 {
+		t.Fatalf("stats not expect: %+v", s)
+	}
+}
+
+func benchmarkTyping(b *testing.B, opts ...Option) {
+	in := strings.Repeat("x", b.N) + "\r"
+	rl, _ := newTestInstance(b, strings.NewReader(in), opts...)
+	b.ResetTimer()
+	if _, err := rl.Readline(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkTyping(b *testing.B) {
+	benchmarkTyping(b)
+}
+
+func BenchmarkTypingListener(b *testing.B) {
+	benchmarkTyping(b, WithListenerFunc(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		return line, pos, true
+	}))
+}
+
+func TestAppendLine(t *testing.T) {
+	rl, _ := newTestInstance(t, strings.NewReader("héllo\rab\rabcd\r"))
+	b, err := rl.AppendLine([]byte("> "))
+	if err != nil || string(b) != "> héllo" {
+		t.Fatal("result not expect", string(b), err)
+	}
+	buf := make([]rune, 3)
+	if n, err := rl.ReadRunesInto(buf); err != nil || string(buf[:n]) != "ab" {
+		t.Fatal("result not expect", string(buf[:n]), err)
+	}
+	if n, err := rl.ReadRunesInto(buf); err != io.ErrShortBuffer || string(buf[:n]) != "abc" {
+		t.Fatal("result not expect", string(buf[:n]), err)
+	}
+
+	rs := []rune("héllo 世界")
+	dst := make([]byte, 0, 64)
+	if n := testing.AllocsPerRun(100, func() { dst = appendRunes(dst[:0], rs) }); n != 0 {
+		t.Fatal("appendRunes allocates", n)
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	// Alt+U upper cases the line, Alt+X has no binding and is dropped,
+	// Alt+B still moves back a word
+	in := bytes.NewBufferString("ab cd\x1bu\x1bx\x1bbx\r")
+	upper := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		return []rune(strings.ToUpper(string(line))), pos, true
+	}
+	rl, _ := newTestInstance(t, in, WithKeyBinding(KeyEvent{'u', ModAlt}, upper))
+
+	line, err := rl.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "AB xCD" {
+		t.Fatal("result not expect", line)
+	}
+}
+
+func TestInputCoalesceWindow(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	var m sync.Mutex
+	var partial, whole int
+	listener := func(line []rune, pos int, key rune) ([]rune, int, bool) {
+		m.Lock()
+		switch string(line) {
+		case "漢":
+			partial++
+		case "漢字":
+			whole++
+		}
+		m.Unlock()
+		return nil, 0, false
+	}
+	rl, _ := newTestInstance(t, r, WithListenerFunc(listener),
+		WithInputCoalesceWindow(50*time.Millisecond))
+
+	// an IME committing one word in two chunks
+	go func() {
+		w.Write([]byte("漢"))
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("字"))
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("\r"))
+	}()
+	line, err := rl.Readline()
+	if err != nil || line != "漢字" {
+		t.Fatal("result not expect", line, err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if partial != 0 || whole != 1 {
+		t.Fatal("result not expect", partial, whole)
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	for _, c := range []struct {
+		policy LengthPolicy
+		expect string
+	}{
+		{LengthReject, "éb"},
+		{LengthTruncate, "éabc"},
+	} {
+		// the paste doesn't fit, then one more rune is typed
+		in := bytes.NewBufferString("é\x1b[5~abcdef\x1b[5~b\r")
+		rl, _ := newTestInstance(t, in, WithMaxLineLength(5, c.policy))
+		line, err := rl.Readline()
+		rl.Close()
+		if err != nil || line != c.expect {
+			t.Fatal("result not expect", c.policy, line, err)
+		}
+	}
+}
+
+func TestReadlineOpts(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("9\r\x085\r1\r"), WithPrompt("> "))
+
+	port := func(line string) error {
+		if _, err := strconv.ParseUint(line, 10, 16); err != nil {
+			return errors.New("not a port")
+		}
+		return nil
+	}
+	line, err := rl.ReadlineOpts(ReadPrompt("port: "), ReadDefault("6553"),
+		ReadMask('*'), ReadValidator(port))
+	if err != nil || line != "65535" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !strings.Contains(out.String(), "port: *****") || strings.Contains(out.String(), "6553") ||
+		!strings.Contains(out.String(), "not a port") {
+		t.Fatalf("output not expect: %q", out.String())
+	}
+
+	line, err = rl.Readline()
+	if err != nil || line != "1" || !strings.Contains(out.String(), "> 1\n") {
+		t.Fatalf("result not expect: %q %v %q", line, err, out.String())
+	}
+}
+
+func TestMaskReveal(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, out := newTestInstance(t, r, WithMask('*'), WithMaskRevealDelay(50*time.Millisecond))
+
+	go func() {
+		w.Write([]byte("ab"))
+		time.Sleep(10 * time.Millisecond)
+		if s := out.String(); !strings.HasSuffix(strings.TrimSuffix(s, cursorShow), "*b") {
+			t.Errorf("b not revealed: %q", s)
+		}
+		time.Sleep(150 * time.Millisecond)
+		if s := out.String(); !strings.HasSuffix(strings.TrimSuffix(s, cursorShow), "**") {
+			t.Errorf("b not masked: %q", s)
+		}
+		w.Write([]byte("\r"))
+	}()
+	line, err := rl.Readline()
+	if err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestInputPattern(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("8x0\x1b[5~\r"),
+		WithInputPattern(regexp.MustCompile(`^[0-9]{0,5}$`), " (digits)"))
+
+	line, err := rl.Readline()
+	if err != nil || line != "80" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !strings.Contains(out.String(), "80 (digits)") {
+		t.Fatalf("output not expect: %q", out.String())
+	}
+}
+
+func TestFixMissingNewline(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("\r"), WithFixMissingNewline("%"))
+	rl.Readline()
+
+	want := "%" + strings.Repeat(" ", 79) + "\r\033[K"
+	if s := out.String(); !strings.HasPrefix(s, want) {
+		t.Fatalf("output not expect %q", s)
+	}
+}
+
+func TestOnResize(t *testing.T) {
+	width := 80
+	rl, _ := newTestInstance(t, strings.NewReader(""),
+		WithWidthFunc(func() int { return width }))
+	if w, h := rl.Size(); w != 80 || h != 24 {
+		t.Fatal("size not expect", w, h)
+	}
+
+	var got [2]int
+	rl.OnResize(func(w, h int) { got = [2]int{w, h} })
+	width = 100
+	rl.Operation.resized()
+	if got != [2]int{100, 24} {
+		t.Fatal("callback not expect", got)
+	}
+	if w, _ := rl.Size(); w != 100 {
+		t.Fatal("size not updated", w)
+	}
+}
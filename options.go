@@ -0,0 +1,332 @@
+package rawterm
+
+import (
+	"io"
+	"regexp"
+	"time"
+)
+
+// WithPrompt sets the prompt, see Config.Prompt.
+func WithPrompt(prompt string) Option {
+	return func(c *Config) {
+		c.Prompt = prompt
+	}
+}
+
+// WithListener sets the Listener called on every key press.
+func WithListener(l Listener) Option {
+	return func(c *Config) {
+		c.Listener = l
+	}
+}
+
+// WithListeners adds ls to Config.Listeners.
+func WithListeners(ls ...Listener) Option {
+	return func(c *Config) {
+		c.Listeners = append(c.Listeners, ls...)
+	}
+}
+
+// WithListenerFunc is WithListener for a plain function.
+func WithListenerFunc(f func(line []rune, pos int, key rune) (newLine []rune, newPos int, ok bool)) Option {
+	return WithListener(FuncListener(f))
+}
+
+// WithMask hides the input behind r, like a password prompt.
+func WithMask(r rune) Option {
+	return func(c *Config) {
+		c.EnableMask = true
+		c.MaskRune = r
+	}
+}
+
+// WithMaskRevealDelay shows each typed character for d before it's masked.
+func WithMaskRevealDelay(d time.Duration) Option {
+	return func(c *Config) {
+		c.MaskRevealDelay = d
+	}
+}
+
+// WithInputPattern only accepts input matching p, showing hint when some
+// is refused. See Config.InputPattern.
+func WithInputPattern(p *regexp.Regexp, hint string) Option {
+	return func(c *Config) {
+		c.InputPattern = p
+		c.InputPatternHint = hint
+	}
+}
+
+// WithInputrc applies the key bindings of the user's inputrc file, see
+// Config.LoadInputrc. A missing file and unsupported lines are ignored.
+func WithInputrc() Option {
+	return func(c *Config) {
+		if p := InputrcPath(); p != "" {
+			c.LoadInputrcFile(p)
+		}
+	}
+}
+
+// WithKeyBinding binds key to h, see Config.Bind.
+func WithKeyBinding(key KeyEvent, h KeyHandler) Option {
+	return func(c *Config) {
+		c.Bind(key, h)
+	}
+}
+
+// WithEscSequenceTimeout sets Config.EscSequenceTimeout, which needs a
+// cancelable Stdin.
+func WithEscSequenceTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.EscSequenceTimeout = d
+	}
+}
+
+// WithEnhancedKeyboard sets Config.EnhancedKeyboard.
+func WithEnhancedKeyboard() Option {
+	return func(c *Config) {
+		c.EnhancedKeyboard = true
+	}
+}
+
+// WithInputCoalesceWindow sets Config.InputCoalesceWindow.
+func WithInputCoalesceWindow(d time.Duration) Option {
+	return func(c *Config) {
+		c.InputCoalesceWindow = d
+	}
+}
+
+// WithMaxLineLength limits lines to n bytes, see Config.MaxLineLength.
+func WithMaxLineLength(n int, policy LengthPolicy) Option {
+	return func(c *Config) {
+		c.MaxLineLength = n
+		c.LengthPolicy = policy
+	}
+}
+
+// WithRecordTo logs every key read from the terminal to w, see
+// Config.RecordTo.
+func WithRecordTo(w io.Writer) Option {
+	return func(c *Config) {
+		c.RecordTo = w
+	}
+}
+
+// WithInterruptPrompt sets the text printed on Ctrl-C.
+func WithInterruptPrompt(s string) Option {
+	return func(c *Config) {
+		c.InterruptPrompt = s
+	}
+}
+
+// WithEOFPrompt sets the text printed on Ctrl-D.
+func WithEOFPrompt(s string) Option {
+	return func(c *Config) {
+		c.EOFPrompt = s
+	}
+}
+
+// WithEOFBehavior sets what happens to an unfinished line on EOF.
+func WithEOFBehavior(b EOFBehavior) Option {
+	return func(c *Config) {
+		c.EOFBehavior = b
+	}
+}
+
+// WithInterruptBehavior sets what Ctrl-C does.
+func WithInterruptBehavior(b InterruptBehavior) Option {
+	return func(c *Config) {
+		c.InterruptBehavior = b
+	}
+}
+
+// WithFlowControl sets who handles Ctrl-S and Ctrl-Q.
+func WithFlowControl(f FlowControl) Option {
+	return func(c *Config) {
+		c.FlowControl = f
+	}
+}
+
+// WithColorMode sets whether the Theme is used regardless of the
+// environment.
+func WithColorMode(m ColorMode) Option {
+	return func(c *Config) {
+		c.ColorMode = m
+	}
+}
+
+// WithIgnoreEOF sets Config.IgnoreEOF, e.g. with "Use exit to leave" as
+// the EOFPrompt.
+func WithIgnoreEOF(n int, prompt string) Option {
+	return func(c *Config) {
+		c.IgnoreEOF = n
+		c.EOFPrompt = prompt
+	}
+}
+
+// WithOnIdle makes f get called after d without a key press while reading
+// a line, see Config.FuncOnIdle.
+func WithOnIdle(d time.Duration, f func(d time.Duration)) Option {
+	return func(c *Config) {
+		c.IdleTimeout = d
+		c.FuncOnIdle = f
+	}
+}
+
+// WithDraftFile keeps the line being typed in path, see Config.Drafts.
+func WithDraftFile(path string) Option {
+	return func(c *Config) {
+		c.Drafts = DraftFile(path)
+	}
+}
+
+// WithExitHandlers enables Config.InstallExitHandlers.
+func WithExitHandlers() Option {
+	return func(c *Config) {
+		c.InstallExitHandlers = true
+	}
+}
+
+// WithUniqueEditLine erases the line after it has been submitted.
+func WithUniqueEditLine() Option {
+	return func(c *Config) {
+		c.UniqueEditLine = true
+	}
+}
+
+// WithHorizontalScroll enables Config.HorizontalScroll.
+func WithHorizontalScroll() Option {
+	return func(c *Config) {
+		c.HorizontalScroll = true
+	}
+}
+
+// WithFixMissingNewline enables Config.FixMissingNewline, marker is left
+// after output which didn't end with a newline, e.g. "⏎".
+func WithFixMissingNewline(marker string) Option {
+	return func(c *Config) {
+		c.FixMissingNewline = true
+		c.MissingNewlineMarker = marker
+	}
+}
+
+// WithWordWrap enables Config.WordWrap.
+func WithWordWrap() Option {
+	return func(c *Config) {
+		c.WordWrap = true
+	}
+}
+
+// WithChatMode enables Config.ChatMode, echo formats accepted lines to be
+// printed above the input and may be nil.
+func WithChatMode(echo func(line []rune) string) Option {
+	return func(c *Config) {
+		c.ChatMode = true
+		c.FuncChatEcho = echo
+	}
+}
+
+// WithFilterInputRune sets Config.FuncFilterInputRune.
+func WithFilterInputRune(f func(rune) (rune, bool)) Option {
+	return func(c *Config) {
+		c.FuncFilterInputRune = f
+	}
+}
+
+// WithStdin reads input from r instead of Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(c *Config) {
+		c.Stdin = r
+	}
+}
+
+// WithTTY enables Config.UseTTY.
+func WithTTY() Option {
+	return func(c *Config) {
+		c.UseTTY = true
+	}
+}
+
+// WithStdout writes output to w instead of Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(c *Config) {
+		c.Stdout = w
+	}
+}
+
+// WithStderr writes errors to w instead of Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(c *Config) {
+		c.Stderr = w
+	}
+}
+
+// WithWidthFunc sets how the terminal width is obtained.
+func WithWidthFunc(f func() int) Option {
+	return func(c *Config) {
+		c.FuncGetWidth = f
+	}
+}
+
+// WithRawMode sets the functions used to enter and leave raw mode.
+func WithRawMode(enter, exit func() error) Option {
+	return func(c *Config) {
+		c.FuncMakeRaw = enter
+		c.FuncExitRaw = exit
+	}
+}
+
+// WithForceInteractive renders the line editor even if stdout is not a tty.
+func WithForceInteractive() Option {
+	return func(c *Config) {
+		c.ForceUseInteractive = true
+	}
+}
+
+// WithLowBandwidth enables Config.LowBandwidth and limits the output to rate
+// bytes per second, 0 for no limit.
+func WithLowBandwidth(rate int) Option {
+	return func(c *Config) {
+		c.LowBandwidth = true
+		c.OutputRateLimit = rate
+	}
+}
+
+// ReadOption changes a single call of Instance.ReadlineOpts.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	prompt   *string
+	mask     *rune
+	validate func(line string) error
+	initial  string
+}
+
+// ReadPrompt shows s as the prompt.
+func ReadPrompt(s string) ReadOption {
+	return func(o *readOptions) {
+		o.prompt = &s
+	}
+}
+
+// ReadMask masks the input with r.
+func ReadMask(r rune) ReadOption {
+	return func(o *readOptions) {
+		o.mask = &r
+	}
+}
+
+// ReadValidator makes Enter ring the bell instead of submitting the line
+// while f returns an error for it, the error is shown next to the line
+// until the next key.
+func ReadValidator(f func(line string) error) ReadOption {
+	return func(o *readOptions) {
+		o.validate = f
+	}
+}
+
+// ReadDefault starts with s as the line, ready to be edited.
+func ReadDefault(s string) ReadOption {
+	return func(o *readOptions) {
+		o.initial = s
+	}
+}
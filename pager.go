@@ -0,0 +1,154 @@
+package rawterm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+)
+
+// Page shows what's read from r one screen at a time, like a simple less:
+// Space, f and Page Down go a screen forward, b and Page Up back, Enter,
+// j and Down a row forward, k and Up back, g and Home to the top, G and
+// End to the bottom, and q, Esc or Ctrl-C quit. Text which fits on the
+// screen, or any text if it isn't a terminal, is just written out.
+//
+// The prompt is taken off the screen meanwhile and drawn again as it was
+// afterwards. Page must not be called from a key handler or listener. It
+// returns io.EOF if the input ends or the Operation is closed.
+func (o *Operation) Page(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	cfg := o.config()
+	width, height := cfg.FuncGetWidth(), cfg.FuncGetHeight()
+	rows := pageRows(b, width)
+	if !cfg.FuncIsTerminal() || width <= 0 || height <= 1 || len(rows) < height {
+		_, err = o.w.Write(b)
+		return err
+	}
+
+	if err := o.t.EnterRawMode(); err != nil {
+		return err
+	}
+	defer o.t.ExitRawMode()
+	g := &keyGrab{keys: make(chan KeyEvent), stop: make(chan struct{})}
+	o.grabKeys(g)
+
+	reading := o.t.IsReading()
+	if reading {
+		o.buf.Clean()
+	}
+	atomic.StoreInt32(&o.paused, 1)
+	o.t.Write([]byte("\033[?1049h"))
+	defer func() {
+		// keys typed from now on are handled as usual
+		close(g.stop)
+		o.grabKeys(nil)
+		o.t.Write([]byte("\033[?1049l"))
+		atomic.StoreInt32(&o.paused, 0)
+		if reading {
+			o.buf.Refresh(nil)
+		}
+	}()
+
+	screen := height - 1
+	last := len(rows) - screen
+	top := 0
+	for {
+		o.t.Write(pageScreen(rows, top, screen, last))
+		if o.ended() {
+			return io.EOF
+		}
+		o.t.KickRead()
+		var ev KeyEvent
+		select {
+		case ev = <-g.keys:
+		case <-o.done:
+			return io.EOF
+		}
+		if ev == (KeyEvent{}) {
+			return io.EOF
+		}
+		switch ev.Rune {
+		case 'q', 'Q', CharEsc, CharInterrupt:
+			return nil
+		case ' ', 'f', KeyPageDown, CharForward:
+			top += screen
+		case 'b', KeyPageUp, CharBackward:
+			top -= screen
+		case CharEnter, CharCtrlJ, 'j', CharNext:
+			top++
+		case 'k', CharPrev:
+			top--
+		case 'g', KeyHome:
+			top = 0
+		case 'G', KeyEnd:
+			top = last
+		default:
+			o.t.Bell()
+		}
+		if top > last {
+			top = last
+		}
+		if top < 0 {
+			top = 0
+		}
+	}
+}
+
+// keyGrab takes the keys for Page until stop is closed.
+type keyGrab struct {
+	keys chan KeyEvent
+	stop chan struct{}
+}
+
+func (o *Operation) grabKeys(g *keyGrab) {
+	o.grabLock.Lock()
+	o.grab = g
+	o.grabLock.Unlock()
+}
+
+func (o *Operation) grabbed() *keyGrab {
+	o.grabLock.Lock()
+	defer o.grabLock.Unlock()
+	return o.grab
+}
+
+// pageRows splits b into the rows it takes up on a screen width wide.
+func pageRows(b []byte, width int) []string {
+	text := strings.TrimSuffix(string(b), "\n")
+	var rows []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if width <= 0 {
+			rows = append(rows, line)
+			continue
+		}
+		split := SplitByLine(0, width, []rune(line))
+		if len(split) > 1 && split[len(split)-1] == "" {
+			// the line filled the last row exactly
+			split = split[:len(split)-1]
+		}
+		rows = append(rows, split...)
+	}
+	return rows
+}
+
+// pageScreen draws n rows from top and the status row below them.
+func pageScreen(rows []string, top, n, last int) []byte {
+	buf := bytes.NewBufferString("\033[H\033[2J")
+	for i := top; i < top+n && i < len(rows); i++ {
+		buf.WriteString(rows[i])
+		buf.WriteString("\r\n")
+	}
+	status := fmt.Sprintf("lines %d-%d/%d", top+1, top+n, len(rows))
+	if top >= last {
+		status += " (END)"
+	}
+	buf.WriteString("\033[7m" + status + "\033[0m")
+	return buf.Bytes()
+}
@@ -0,0 +1,127 @@
+package rawterm
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPage(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, out := newTestInstance(t, r, func(c *Config) {
+		c.FuncIsTerminal = func() bool { return true }
+		c.FuncGetHeight = func() int { return 4 }
+	})
+
+	go w.Write([]byte(" xq"))
+	if err := rl.Page(strings.NewReader("1\n2\n3\n4\n5\n6\n7\n")); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	for _, want := range []string{"\033[?1049h", "1\r\n2\r\n3\r\n", "lines 4-6/7", "\033[?1049l"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("%q not in output %q", want, s)
+		}
+	}
+
+	// short text is just written out, and reading goes on as usual
+	n := len(out.String())
+	rl.Page(strings.NewReader("short\n"))
+	if s := out.String()[n:]; s != "short\n" {
+		t.Fatalf("output not expect %q", s)
+	}
+	go w.Write([]byte("ok\r"))
+	if line, err := rl.Readline(); err != nil || line != "ok" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPageEnd(t *testing.T) {
+	page := func(rl *Instance) error {
+		done := make(chan error, 1)
+		go func() { done <- rl.Page(strings.NewReader("1\n2\n3\n")) }()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(2 * time.Second):
+			t.Fatal("Page blocked")
+			return nil
+		}
+	}
+	height := func(c *Config) {
+		c.FuncIsTerminal = func() bool { return true }
+		c.FuncGetHeight = func() int { return 2 }
+	}
+
+	// the input ends while paging, and before
+	rl, _ := newTestInstance(t, strings.NewReader(""), height)
+	for i := 0; i < 2; i++ {
+		if err := page(rl); err != io.EOF {
+			t.Fatal("error not expect", err)
+		}
+	}
+
+	// the Instance is closed while paging
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, out := newTestInstance(t, r, height)
+	go func() {
+		for !strings.Contains(out.String(), "lines") {
+			time.Sleep(time.Millisecond)
+		}
+		rl.Close()
+	}()
+	if err := page(rl); err != io.EOF {
+		t.Fatal("error not expect", err)
+	}
+}
+
+// slowWriter takes a while for writes containing slow, like a terminal
+// busy repainting.
+type slowWriter struct {
+	syncBuffer
+	slow string
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte(w.slow)) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return w.syncBuffer.Write(p)
+}
+
+func TestPageTypeAhead(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	out := &slowWriter{slow: "\033[?1049l"}
+	rl, err := NewWithStreams(r, out, func(c *Config) {
+		c.FuncIsTerminal = func() bool { return true }
+		c.FuncGetHeight = func() int { return 2 }
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	// the keys after q arrive while the pager restores the screen
+	go w.Write([]byte("qok\r"))
+	if err := rl.Page(strings.NewReader("1\n2\n3\n")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan string, 1)
+	go func() {
+		line, _ := rl.Readline()
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		if line != "ok" {
+			t.Fatal("result not expect", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("keys typed after the pager were lost")
+	}
+}
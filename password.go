@@ -20,12 +20,14 @@ func (o *opPassword) EnterPasswordMode(cfg *Config) (err error) {
 }
 
 func (o *opPassword) PasswordConfig() *Config {
+	cfg := o.o.config()
 	return &Config{
 		EnableMask:      true,
 		InterruptPrompt: "\n",
 		EOFPrompt:       "\n",
 
-		Stdout: o.o.cfg.Stdout,
-		Stderr: o.o.cfg.Stderr,
+		Stdin:  cfg.Stdin,
+		Stdout: cfg.Stdout,
+		Stderr: cfg.Stderr,
 	}
 }
@@ -0,0 +1,88 @@
+package rawterm
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PromptProvider returns the text of a placeholder in Config.PromptTemplate.
+// It's called whenever the line is redrawn, so it should be fast.
+type PromptProvider func() string
+
+// SetPromptProvider makes {name} in PromptTemplate expand to the result of
+// p, replacing the built-in placeholder of that name if there is one.
+func (c *Config) SetPromptProvider(name string, p PromptProvider) {
+	if c.PromptProviders == nil {
+		c.PromptProviders = make(map[string]PromptProvider)
+	}
+	c.PromptProviders[name] = p
+}
+
+// SetPromptStatus sets the text of {status} in the prompt template, e.g.
+// the exit code of the last command. It shows up on the next refresh.
+func (o *Operation) SetPromptStatus(s string) {
+	o.status.Store(s)
+}
+
+// PromptCounter returns {n} of the prompt template, the number of the line
+// being read counting only the non-empty lines entered, like "In [3]:" of
+// IPython.
+func (o *Operation) PromptCounter() int {
+	return int(atomic.LoadInt32(&o.counter)) + 1
+}
+
+// SetPromptCounter makes {n} start over at n, e.g. 1 to reset it.
+func (o *Operation) SetPromptCounter(n int) {
+	atomic.StoreInt32(&o.counter, int32(n-1))
+}
+
+// expandPrompt fills in the placeholders of Config.PromptTemplate, unknown
+// ones are left as they are.
+func (o *Operation) expandPrompt() string {
+	cfg := o.config()
+	tpl := cfg.PromptTemplate
+	buf := bytes.NewBuffer(nil)
+	for {
+		i := strings.IndexByte(tpl, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(tpl[i:], '}')
+		if j < 0 {
+			break
+		}
+		buf.WriteString(tpl[:i])
+		if v, ok := o.promptVar(cfg, tpl[i+1:i+j]); ok {
+			buf.WriteString(v)
+		} else {
+			buf.WriteString(tpl[i : i+j+1])
+		}
+		tpl = tpl[i+j+1:]
+	}
+	buf.WriteString(tpl)
+	return buf.String()
+}
+
+func (o *Operation) promptVar(cfg *Config, name string) (string, bool) {
+	if p, ok := cfg.PromptProviders[name]; ok {
+		return p(), true
+	}
+	switch name {
+	case "time":
+		return time.Now().Format("15:04:05"), true
+	case "histno":
+		return strconv.Itoa(int(atomic.LoadInt32(&o.lineNo)) + 1), true
+	case "n":
+		return strconv.Itoa(o.PromptCounter()), true
+	case "mode":
+		mode, _ := o.mode.Load().(string)
+		return mode, true
+	case "status":
+		status, _ := o.status.Load().(string)
+		return status, true
+	}
+	return "", false
+}
@@ -0,0 +1,49 @@
+package rawterm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("a\r\x188e9\r\r"))
+	err := rl.UpdateConfig(func(c *Config) {
+		c.PromptTemplate = "[{histno}{mode}] {user}{status}{none}> "
+		c.SetPromptProvider("user", func() string { return "bob" })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"[1] bob{none}> a", "[2char: e9] bob1{none}> "} {
+		if _, err := rl.Readline(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("output not expect: %q", out.String())
+		}
+		rl.SetPromptStatus("1")
+	}
+}
+
+func TestPromptCounter(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("a\r\rb\rc\r"), func(c *Config) {
+		c.PromptTemplate = "In [{n}]: "
+	})
+
+	for _, expect := range []string{"In [1]: a", "In [2]: ", "In [2]: b"} {
+		if _, err := rl.Readline(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("output not expect: %q", out.String())
+		}
+	}
+	if n := rl.PromptCounter(); n != 3 {
+		t.Fatal("counter not expect", n)
+	}
+	rl.SetPromptCounter(1)
+	if _, err := rl.Readline(); err != nil || !strings.Contains(out.String(), "In [1]: c") {
+		t.Fatalf("output not expect: %q %v", out.String(), err)
+	}
+}
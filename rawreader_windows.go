@@ -2,7 +2,11 @@
 
 package rawterm
 
-import "unsafe"
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
 
 const (
 	VK_CANCEL   = 0x03
@@ -13,11 +17,28 @@ const (
 	VK_CONTROL  = 0x11
 	VK_MENU     = 0x12
 	VK_ESCAPE   = 0x1B
+	VK_PRIOR    = 0x21
+	VK_NEXT     = 0x22
+	VK_END      = 0x23
+	VK_HOME     = 0x24
 	VK_LEFT     = 0x25
 	VK_UP       = 0x26
 	VK_RIGHT    = 0x27
 	VK_DOWN     = 0x28
+	VK_INSERT   = 0x2D
 	VK_DELETE   = 0x2E
+	VK_F1       = 0x70
+	VK_F2       = 0x71
+	VK_F3       = 0x72
+	VK_F4       = 0x73
+	VK_F5       = 0x74
+	VK_F6       = 0x75
+	VK_F7       = 0x76
+	VK_F8       = 0x77
+	VK_F9       = 0x78
+	VK_F10      = 0x79
+	VK_F11      = 0x7A
+	VK_F12      = 0x7B
 	VK_LSHIFT   = 0xA0
 	VK_RSHIFT   = 0xA1
 	VK_LCONTROL = 0xA2
@@ -27,22 +48,56 @@ const (
 // RawReader translate input record to ANSI escape sequence.
 // To provides same behavior as unix terminal.
 type RawReader struct {
+	// the console input handle the events are read from
+	handle uintptr
+
 	ctrlKey bool
 	altKey  bool
+
+	// high half of an utf-16 surrogate pair waiting for its low half
+	surrogate rune
 }
 
 func NewRawReader() *RawReader {
-	r := new(RawReader)
+	return newRawReader(stdin)
+}
+
+// newRawReader reads the events of the console input handle h.
+func newRawReader(h uintptr) *RawReader {
+	r := &RawReader{handle: h}
 	return r
 }
 
-// only process one action in one read
+// Read process one action, followed by whatever is already queued in the
+// console input buffer. A paste arrives as a burst of key events, returning
+// them in one read lets the terminal handle them as one chunk.
 func (r *RawReader) Read(buf []byte) (int, error) {
+	n, err := r.read(buf, true)
+	for err == nil && n > 0 && len(buf)-n > utf8.UTFMax {
+		var m int
+		m, err = r.read(buf[n:], false)
+		if m == 0 {
+			break
+		}
+		n += m
+	}
+	if n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// read translates the next key event into buf. If block is false it returns
+// 0 instead of waiting when the console input buffer is empty.
+func (r *RawReader) read(buf []byte, block bool) (int, error) {
 	ir := new(_INPUT_RECORD)
 	var read int
 	var err error
 next:
-	err = kernel.ReadConsoleInputW(stdin,
+	if !block && !r.hasEvents() {
+		return 0, nil
+	}
+	err = kernel.ReadConsoleInputW(r.handle,
 		uintptr(unsafe.Pointer(ir)),
 		1,
 		uintptr(unsafe.Pointer(&read)),
@@ -50,6 +105,10 @@ next:
 	if err != nil {
 		return 0, err
 	}
+	if ir.EventType == EVENT_WINDOW_BUFFER_SIZE {
+		notifyWidthChanged()
+		goto next
+	}
 	if ir.EventType != EVENT_KEY {
 		goto next
 	}
@@ -85,9 +144,22 @@ next:
 		if target != 0 {
 			return r.write(buf, target)
 		}
+		if seq, ok := vkSequences[ker.wVirtualKeyCode]; ok {
+			return copy(buf, seq), nil
+		}
 		goto next
 	}
 	char := rune(ker.unicodeChar)
+	if utf16.IsSurrogate(char) {
+		if r.surrogate == 0 {
+			r.surrogate = char
+			goto next
+		}
+		char = utf16.DecodeRune(r.surrogate, char)
+		r.surrogate = 0
+	} else {
+		r.surrogate = 0
+	}
 	if r.ctrlKey {
 		switch char {
 		case 'A':
@@ -109,6 +181,35 @@ next:
 	return r.write(buf, char)
 }
 
+// the xterm sequences sent for keys without a character, they're decoded
+// by the terminal like any other
+var vkSequences = map[word]string{
+	VK_PRIOR:  "\033[5~",
+	VK_NEXT:   "\033[6~",
+	VK_END:    "\033[F",
+	VK_HOME:   "\033[H",
+	VK_INSERT: "\033[2~",
+	VK_DELETE: "\033[3~",
+	VK_F1:     "\033OP",
+	VK_F2:     "\033OQ",
+	VK_F3:     "\033OR",
+	VK_F4:     "\033OS",
+	VK_F5:     "\033[15~",
+	VK_F6:     "\033[17~",
+	VK_F7:     "\033[18~",
+	VK_F8:     "\033[19~",
+	VK_F9:     "\033[20~",
+	VK_F10:    "\033[21~",
+	VK_F11:    "\033[23~",
+	VK_F12:    "\033[24~",
+}
+
+func (r *RawReader) hasEvents() bool {
+	var n int
+	err := kernel.GetNumberOfConsoleInputEvents(r.handle, uintptr(unsafe.Pointer(&n)))
+	return err == nil && n > 0
+}
+
 func (r *RawReader) writeEsc(b []byte, char rune) (int, error) {
 	b[0] = '\033'
 	n := copy(b[1:], []byte(string(char)))
@@ -17,26 +17,144 @@
 //
 package rawterm
 
-import "io"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
 
 type Instance struct {
 	Config    *Config
 	Terminal  *Terminal
 	Operation *Operation
+
+	// set for an Instance made by Nest, Close calls it instead
+	unnest func()
+	// opened by Config.Init for UseTTY, closed with the Instance
+	tty *os.File
 }
 
 type Config struct {
 	// prompt supports ANSI escape sequence, so we can color some characters even in windows
 	Prompt string
 
+	// a prompt with placeholders which are filled in whenever the line is
+	// drawn, it's used instead of Prompt if set. The built-in ones are
+	// {time}, {histno} (the number of the line being read), {n} (the same
+	// but only counting non-empty lines, see PromptCounter), {mode} (the
+	// editing mode, empty unless e.g. a character is entered by code point)
+	// and {status} (set with SetPromptStatus), more can be added with
+	// SetPromptProvider.
+	PromptTemplate  string
+	PromptProviders map[string]PromptProvider
+
 	// Any key press will pass to Listener
 	// NOTE: Listener will be triggered by (nil, 0, 0) immediately
 	Listener Listener
+	// more listeners called after Listener in this order, each gets the
+	// line as changed by the ones before
+	Listeners []Listener
+	// call the listeners only once no key was pressed for this long, with
+	// the last key. Enter, Ctrl-C and Ctrl-D are delivered right away.
+	ListenerDebounce time.Duration
+
+	// every key read from the terminal is logged here, see Operation.Replay
+	// for the format
+	RecordTo io.Writer
+
+	// keys bound to a handler instead of their default action, see Bind.
+	// The handlers run with the line locked, calling SetConfig or
+	// UpdateConfig from one deadlocks.
+	KeyBindings map[KeyEvent]KeyHandler
+	// keys bound to a handler which runs in the background, see BindAsync
+	AsyncBindings map[KeyEvent]AsyncKeyHandler
+	// shown after the line while an AsyncKeyHandler runs, "…" by default
+	AsyncHint string
+	// keys which do what another key does by default, e.g. Alt+D mapped to
+	// CharKill deletes to the end of the line. See LoadInputrc.
+	KeyMap map[KeyEvent]rune
+
+	// how long to wait after ESC for the rest of an escape sequence, if
+	// nothing arrives the ESC is delivered as a key of its own, which can
+	// be bound with Bind(KeyEvent{Rune: CharEsc}, ...).
+	// 0 waits forever, so ESC only starts sequences. The wait is ended by
+	// canceling the read of Stdin, which needs a reader with a Cancel
+	// method like CancelableStdin or the default Stdin. With any other the
+	// ESC waits for the next input.
+	EscSequenceTimeout time.Duration
+
+	// what happens to input which isn't valid UTF-8, by default each
+	// invalid byte is read as U+FFFD
+	InvalidUTF8 InvalidUTF8Policy
+
+	// a Ctrl-C skips the input which arrived before it but wasn't handled
+	// yet if there's a lot of it, e.g. the rest of a large paste.
+	// StrictInputOrder handles all input in order instead.
+	// Ctrl-D always waits its turn: it's EOF only on an empty line,
+	// which isn't known until the input before it is handled.
+	StrictInputOrder bool
+
+	// ask the terminal to mark pasted text, which is then inserted in one
+	// go. Line breaks in it become spaces so a paste can't enter the line.
+	BracketedPaste bool
+
+	// for terminals which don't use UTF-8, e.g. Latin1 or CP437. Input is
+	// decoded with InputEncoding, output to Stdout and Stderr is encoded
+	// with OutputEncoding, which defaults to InputEncoding. nil is UTF-8.
+	InputEncoding  Encoding
+	OutputEncoding Encoding
+
+	// ask the terminal to report keys like Ctrl+Shift+A or Ctrl+Enter
+	// with their modifiers, using the kitty keyboard protocol or xterm's
+	// modifyOtherKeys. Terminals without either keep sending plain keys.
+	EnhancedKeyboard bool
+
+	// the key which starts entering a character by its hex code point or
+	// a digraph, the default is the chord Ctrl-X 8. A Ctrl-X in KeyBindings,
+	// AsyncBindings or KeyMap disables the default.
+	UnicodeEntryKey     KeyEvent
+	DisableUnicodeEntry bool
+
+	// wait this long for more input after a typed character before the
+	// line is updated and the Listener is called, so text an IME commits
+	// in several chunks is inserted at once. 0 only batches input which
+	// has already arrived.
+	InputCoalesceWindow time.Duration
 
 	InterruptPrompt string
 	EOFPrompt       string
 
-	FuncGetWidth func() int
+	// what Ctrl-C does
+	InterruptBehavior InterruptBehavior
+
+	// called when Ctrl-D on an empty line or Ctrl-C would end the read
+	// with io.EOF or ErrInterrupt, if it returns false editing goes on.
+	// It may ask with Confirm, e.g. "really quit? [y/n]".
+	FuncConfirmExit func(reason error) bool
+
+	// what to do with an unfinished line when Stdin reaches EOF
+	EOFBehavior EOFBehavior
+	// the number of times in a row Ctrl-D on an empty line only shows
+	// EOFPrompt, like IGNOREEOF of bash. The next one returns io.EOF.
+	IgnoreEOF int
+
+	// the longest line in bytes of UTF-8 the user can enter, 0 means no
+	// limit. LengthPolicy decides what happens to input beyond it.
+	MaxLineLength int
+	LengthPolicy  LengthPolicy
+
+	// typed characters which would make the line not match InputPattern
+	// are refused with a bell and InputPatternHint shown next to the line.
+	// The pattern is checked while typing, so it has to match every
+	// prefix of a valid line, e.g. `^[0-9]{0,5}$` for a port number.
+	InputPattern     *regexp.Regexp
+	InputPatternHint string
+
+	FuncGetWidth  func() int
+	FuncGetHeight func() int
 
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -44,15 +162,99 @@ type Config struct {
 
 	EnableMask bool
 	MaskRune   rune
+	// show each typed character this long before masking it, or until the
+	// next key is pressed
+	MaskRevealDelay time.Duration
+
+	// expanded when typed as a command, see AddAbbrev
+	Abbreviations map[string]string
+
+	// apply ExpandLine to each line when it's submitted
+	ExpandOnAccept bool
 
 	// erase the editing line after user submited it
 	// it use in IM usually.
 	UniqueEditLine bool
 
+	// don't hide the cursor while the line is repainted
+	DisableHideCursor bool
+
+	// the number of cells a tab in the line is drawn as, 0 means the
+	// package level TabWidth
+	TabWidth int
+	// draw tabs as ^I instead of blanks
+	TabAsCaret bool
+
+	// start the prompt on a new line if the output before it didn't end
+	// with one, leaving MissingNewlineMarker after that output
+	FixMissingNewline    bool
+	MissingNewlineMarker string
+
+	// show the opening bracket or quote matching the one under or before
+	// the cursor in bold
+	HighlightMatchingBracket bool
+
+	// keep the line on a single row and scroll it sideways when it's
+	// longer than the terminal, with '<' and '>' marking the hidden parts
+	HorizontalScroll bool
+
+	// wrap a line longer than the terminal before a word instead of in the
+	// middle of it, only the way it's shown changes
+	WordWrap bool
+
+	// keep the input on the terminal's last row and print what's written
+	// to Stdout() and Stderr() in a scroll region above it, for chat-like
+	// programs. It implies UniqueEditLine and HorizontalScroll.
+	ChatMode bool
+	// formats an accepted line to be printed above the input in ChatMode,
+	// nil doesn't print it
+	FuncChatEcho func(line []rune) string
+
+	// only write the changed part of the line using plain backspaces
+	// instead of clearing and repainting it, for slow links like a 9600
+	// baud serial console.
+	LowBandwidth bool
+	// limit output to Stdout to this many bytes per second, 0 means no limit
+	OutputRateLimit int
+
+	// called with the signal Ctrl-C, Ctrl-Z or Ctrl-\ would have sent
+	// outside of raw mode, e.g. to pass it on to a child process. If it
+	// returns true the key is dropped, otherwise it's handled as usual.
+	FuncOnSignal func(sig os.Signal) bool
+
+	// FuncOnIdle is called while reading a line when no key was pressed
+	// for IdleTimeout, and again after every further IdleTimeout, with the
+	// time since the last key press. FuncOnActivity gets the same once
+	// typing resumes after FuncOnIdle was called.
+	IdleTimeout    time.Duration
+	FuncOnIdle     func(d time.Duration)
+	FuncOnActivity func(d time.Duration)
+
+	// Drafts saves the line being typed DraftDelay (default 500ms) after
+	// it last changed, and when the Instance is closed. If a draft is left
+	// from a read which didn't finish, the next read starts with it and
+	// shows DraftHint.
+	Drafts     DraftStore
+	DraftDelay time.Duration
+	DraftHint  string
+
+	// colors of the prompt, hints and widgets, see ActiveTheme
+	Theme     *Theme
+	ColorMode ColorMode
+
+	// called instead of writing "\a" whenever the bell would ring, e.g.
+	// to flash the screen or, with an empty func, to silence it
+	FuncBell func()
+
 	// filter input runes (may be used to disable CtrlZ or for translating some keys to different actions)
 	// -> output = new (translated) rune and true/false if continue with processing this one
 	FuncFilterInputRune func(rune) (rune, bool)
 
+	// read keys from the controlling terminal (/dev/tty, CONIN$ on Windows)
+	// if Stdin isn't one, e.g. in `echo data | prog`, and leave Stdin to
+	// the program. It only applies if Stdin isn't set.
+	UseTTY bool
+
 	// force use interactive even stdout is not a tty
 	FuncIsTerminal      func() bool
 	FuncMakeRaw         func() error
@@ -60,8 +262,89 @@ type Config struct {
 	FuncOnWidthChanged  func(func())
 	ForceUseInteractive bool
 
+	// what the default FuncMakeRaw leaves enabled, and a hook to change the
+	// raw setup before it's applied, e.g. VMIN/VTIME or clearing OPOST
+	RawModeFlags   RawModeFlags
+	FuncRawTermios func(*Termios)
+
+	// leave Ctrl-C and Ctrl-Z to the terminal, which sends SIGINT and
+	// SIGTSTP to the whole foreground job, and handle the signals while
+	// reading as if the keys were read. Implies RawKeepSignals.
+	KernelSignals bool
+
+	// who gets Ctrl-S and Ctrl-Q
+	FlowControl FlowControl
+
+	// on SIGTERM or SIGHUP restore the terminals, run the AtExit funcs,
+	// e.g. to save the history, and close the instances before the signal
+	// ends the process
+	InstallExitHandlers bool
+
 	// private fields
 	inited bool
+	tty    *os.File
+	// Stdin is the console or tty, which a Terminal reads through a
+	// cancelable reader of its own, see NewTerminal
+	wrapStdin bool
+}
+
+// EOFBehavior is what happens to the unfinished line when Stdin reaches EOF.
+// Ctrl-D is not affected, it only returns io.EOF on an empty line.
+type EOFBehavior int
+
+const (
+	// submit the line as if Enter was pressed, io.EOF is returned by the
+	// next read.
+	EOFSubmit EOFBehavior = iota
+	// drop the line and return io.EOF.
+	EOFDiscard
+	// return the line together with io.EOF.
+	EOFReturnPartial
+)
+
+// InterruptBehavior is what happens when Ctrl-C is pressed.
+type InterruptBehavior int
+
+const (
+	// give up the line, the read returns an *InterruptError with it.
+	InterruptAbort InterruptBehavior = iota
+	// show InterruptPrompt, drop the line and start over with an empty
+	// one, the read goes on.
+	InterruptClearLine
+	// leave the line alone and only pass the key on to the Listener.
+	InterruptForward
+)
+
+// FlowControl is who handles Ctrl-S and Ctrl-Q.
+type FlowControl int
+
+const (
+	// turn off the terminal's flow control, Ctrl-S and Ctrl-Q are read as
+	// keys and can be bound. Unbound Ctrl-S rings the bell.
+	FlowControlKeys FlowControl = iota
+	// leave flow control on, so Ctrl-S stops the output until Ctrl-Q. The
+	// keys are dropped if they're read anyway, e.g. on Windows.
+	FlowControlTerminal
+)
+
+// LengthPolicy is what happens to input which would make the line longer
+// than Config.MaxLineLength.
+type LengthPolicy int
+
+const (
+	// ring the bell and drop all of the input, a paste which doesn't fit
+	// is not inserted at all.
+	LengthReject LengthPolicy = iota
+	// insert as much of the input as fits and drop the rest.
+	LengthTruncate
+)
+
+// listeners returns Listener and Listeners.
+func (c *Config) listeners() []Listener {
+	if c.Listener == nil {
+		return c.Listeners
+	}
+	return append([]Listener{c.Listener}, c.Listeners...)
 }
 
 func (c *Config) useInteractive() bool {
@@ -71,19 +354,56 @@ func (c *Config) useInteractive() bool {
 	return c.FuncIsTerminal()
 }
 
+// Clone returns a copy of the config which will be initialized again when it
+// is used.
+func (c *Config) Clone() *Config {
+	if c == nil {
+		return nil
+	}
+	cc := *c
+	cc.inited = false
+	return &cc
+}
+
 func (c *Config) Init() error {
 	if c.inited {
 		return nil
 	}
 	c.inited = true
+	if c.UseTTY && c.Stdin == nil && !IsTerminal(GetStdin()) {
+		if tty, err := openTTY(); err == nil {
+			c.tty = tty
+			c.Stdin, c.wrapStdin = ttyInput(tty), true
+		}
+	}
+	// the package streams are only defaults, the console wrappers are
+	// made for each config so instances don't share their state
 	if c.Stdin == nil {
-		c.Stdin = NewCancelableStdin(Stdin)
+		c.Stdin, c.wrapStdin = consoleInput(Stdin), true
 	}
 	if c.Stdout == nil {
-		c.Stdout = Stdout
+		c.Stdout = consoleOutput(Stdout)
+	}
+	if c.MaxLineLength < 0 {
+		return errors.New("MaxLineLength must not be negative")
+	}
+	if c.OutputRateLimit < 0 {
+		return errors.New("OutputRateLimit must not be negative")
+	}
+	if w, ok := c.Stdout.(*rateLimitWriter); ok {
+		// a Clone() of a config which was already initialized
+		c.Stdout = w.w
 	}
 	if c.Stderr == nil {
-		c.Stderr = Stderr
+		c.Stderr = consoleOutput(Stderr)
+	}
+	if c.OutputEncoding == nil {
+		c.OutputEncoding = c.InputEncoding
+	}
+	c.Stdout = encodeOutput(c.Stdout, c.OutputEncoding)
+	c.Stderr = encodeOutput(c.Stderr, c.OutputEncoding)
+	if c.OutputRateLimit > 0 {
+		c.Stdout = newRateLimitWriter(c.Stdout, c.OutputRateLimit)
 	}
 
 	if c.InterruptPrompt == "" {
@@ -100,10 +420,27 @@ func (c *Config) Init() error {
 	if c.FuncGetWidth == nil {
 		c.FuncGetWidth = GetScreenWidth
 	}
+	if c.FuncGetHeight == nil {
+		c.FuncGetHeight = GetScreenHeight
+	}
+	if c.ChatMode {
+		c.UniqueEditLine = true
+		c.HorizontalScroll = true
+	}
 	if c.FuncIsTerminal == nil {
 		c.FuncIsTerminal = DefaultIsTerminal
+		if c.tty != nil {
+			fd := int(c.tty.Fd())
+			c.FuncIsTerminal = func() bool { return IsTerminal(fd) }
+		}
+	}
+	if c.KernelSignals {
+		c.RawModeFlags |= RawKeepSignals
 	}
-	rm := new(RawMode)
+	if c.FlowControl == FlowControlTerminal {
+		c.RawModeFlags |= RawKeepFlowControl
+	}
+	rm := &RawMode{tty: c.tty, flags: c.RawModeFlags, termios: c.FuncRawTermios}
 	if c.FuncMakeRaw == nil {
 		c.FuncMakeRaw = rm.Enter
 	}
@@ -121,23 +458,61 @@ func (c *Config) SetListener(f func(line []rune, pos int, key rune) (newLine []r
 	c.Listener = FuncListener(f)
 }
 
-func NewEx(cfg *Config) (*Instance, error) {
+// NewEx creates an Instance from cfg, which may be nil, after applying opts
+// to it. The Config must not be changed afterwards except through SetConfig.
+func NewEx(cfg *Config, opts ...Option) (*Instance, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 	t, err := NewTerminal(cfg)
 	if err != nil {
 		return nil, err
 	}
 	rl := t.Readline()
-	return &Instance{
+	i := &Instance{
 		Config:    cfg,
 		Terminal:  t,
 		Operation: rl,
-	}, nil
+		tty:       cfg.tty,
+	}
+	registerInstance(i)
+	if cfg.InstallExitHandlers {
+		installExitHandlers()
+	}
+	return i, nil
 }
 
 func New(prompt string) (*Instance, error) {
 	return NewEx(&Config{Prompt: prompt})
 }
 
+// Option changes the Config an Instance is created with.
+type Option func(*Config)
+
+// NewWithStreams creates an Instance on top of in and out without using the
+// package level Stdin/Stdout or the process terminal. No raw mode syscalls are
+// made unless FuncMakeRaw is set by an option, so it can be embedded in GUIs,
+// tests or servers handling several sessions.
+func NewWithStreams(in io.Reader, out io.Writer, opts ...Option) (*Instance, error) {
+	cfg := &Config{
+		// wrapped so that Close won't close the caller's reader
+		Stdin:  NewCancelableStdin(in),
+		Stdout: out,
+		Stderr: out,
+
+		FuncGetWidth:       func() int { return 80 },
+		FuncGetHeight:      func() int { return 24 },
+		FuncIsTerminal:     func() bool { return true },
+		FuncMakeRaw:        func() error { return nil },
+		FuncExitRaw:        func() error { return nil },
+		FuncOnWidthChanged: func(func()) {},
+	}
+	return NewEx(cfg, opts...)
+}
+
 func (i *Instance) SetPrompt(s string) {
 	i.Operation.SetPrompt(s)
 }
@@ -196,22 +571,172 @@ func (i *Instance) Readline() (string, error) {
 	return i.Operation.String()
 }
 
+// ReadlineContext is Readline which returns ctx.Err() once ctx is done,
+// dropping the unfinished line.
+func (i *Instance) ReadlineContext(ctx context.Context) (string, error) {
+	r, err := i.Operation.RunesContext(ctx)
+	return string(r), err
+}
+
+// ReadlineTimeout is Readline which gives up after d, returning
+// context.DeadlineExceeded.
+func (i *Instance) ReadlineTimeout(d time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return i.ReadlineContext(ctx)
+}
+
 // same as readline
 func (i *Instance) ReadSlice() ([]byte, error) {
 	return i.Operation.Slice()
 }
 
-// we must make sure that call Close() before process exit.
-func (i *Instance) Close() error {
-	if err := i.Terminal.Close(); err != nil {
+// AppendLine is ReadSlice which appends the line to dst.
+func (i *Instance) AppendLine(dst []byte) ([]byte, error) {
+	return i.Operation.AppendLine(dst)
+}
+
+// ReadRunesInto is Readline which copies the line into buf, see
+// Operation.ReadRunesInto.
+func (i *Instance) ReadRunesInto(buf []rune) (int, error) {
+	return i.Operation.ReadRunesInto(buf)
+}
+
+// ReadlineOpts reads a line with options that only apply to this call,
+// like a different prompt or a validator.
+func (i *Instance) ReadlineOpts(opts ...ReadOption) (string, error) {
+	r, err := i.Operation.RunesOpts(context.Background(), opts...)
+	return string(r), err
+}
+
+// AddAbbrev adds an abbreviation, see Config.AddAbbrev.
+func (i *Instance) AddAbbrev(abbr, expansion string) {
+	i.Operation.AddAbbrev(abbr, expansion)
+}
+
+// OnResize sets a func which is called with the new size whenever the
+// terminal is resized.
+func (i *Instance) OnResize(f func(width, height int)) {
+	i.Operation.OnResize(f)
+}
+
+// Size returns the width and height of the terminal.
+func (i *Instance) Size() (width, height int) {
+	return i.Operation.Size()
+}
+
+// Stats returns how much drawing the keys read so far caused.
+func (i *Instance) Stats() Stats {
+	return i.Operation.Stats()
+}
+
+// Stats counts the work done by an Instance, to notice when drawing the
+// line gets more expensive.
+type Stats struct {
+	// keys read from the terminal
+	Keys int64
+	// times the line was redrawn
+	Refreshes int64
+	// bytes written to the terminal, without what was written through
+	// Stdout and Stderr
+	BytesWritten int64
+}
+
+// RefreshesPerKey returns Refreshes / Keys.
+func (s Stats) RefreshesPerKey() float64 {
+	if s.Keys == 0 {
+		return 0
+	}
+	return float64(s.Refreshes) / float64(s.Keys)
+}
+
+// BytesPerKey returns BytesWritten / Keys.
+func (s Stats) BytesPerKey() float64 {
+	if s.Keys == 0 {
+		return 0
+	}
+	return float64(s.BytesWritten) / float64(s.Keys)
+}
+
+// SetPromptStatus sets {status} of the prompt template.
+func (i *Instance) SetPromptStatus(s string) {
+	i.Operation.SetPromptStatus(s)
+}
+
+// PromptCounter returns {n} of the prompt template, see
+// Operation.PromptCounter.
+func (i *Instance) PromptCounter() int {
+	return i.Operation.PromptCounter()
+}
+
+// SetPromptCounter makes {n} start over at n.
+func (i *Instance) SetPromptCounter(n int) {
+	i.Operation.SetPromptCounter(n)
+}
+
+// StartRecording records all output to the terminal from now on as an
+// asciicast v2 file to w, until StopRecording is called.
+func (i *Instance) StartRecording(w io.Writer) error {
+	cfg := i.Operation.config()
+	a, err := NewAsciicastWriter(w, cfg.FuncGetWidth(), recordHeight(cfg.FuncGetHeight()))
+	if err != nil {
 		return err
 	}
+	i.Terminal.SetRecorder(a)
 	return nil
 }
+
+// StopRecording ends a recording started by StartRecording.
+func (i *Instance) StopRecording() {
+	i.Terminal.SetRecorder(nil)
+}
+
+// Replay types the key events recorded with Config.RecordTo, see
+// Operation.Replay.
+func (i *Instance) Replay(r io.Reader, speed float64) error {
+	return i.Operation.Replay(r, speed)
+}
+
+// we must make sure that call Close() before process exit.
+// Close stops reading, restores the terminal and can be called more than once.
+func (i *Instance) Close() error {
+	if i.unnest != nil {
+		i.unnest()
+		return nil
+	}
+	unregisterInstance(i)
+	i.Operation.Close()
+	err := i.Terminal.Close()
+	if i.tty != nil {
+		i.tty.Close()
+	}
+	return err
+}
+
+// Closed returns a channel which is closed once Close has been called.
+func (i *Instance) Closed() <-chan struct{} {
+	return i.Operation.Closed()
+}
+
 func (i *Instance) Clean() {
 	i.Operation.Clean()
 }
 
+// Confirm asks a yes or no question, see Operation.Confirm.
+func (i *Instance) Confirm(question string) bool {
+	return i.Operation.Confirm(question)
+}
+
+// Pause clears the prompt until resume is called, see Operation.Pause.
+func (i *Instance) Pause() (resume func()) {
+	return i.Operation.Pause()
+}
+
+// Page shows the text of r in a pager, see Operation.Page.
+func (i *Instance) Page(r io.Reader) error {
+	return i.Operation.Page(r)
+}
+
 func (i *Instance) Write(b []byte) (int, error) {
 	return i.Stdout().Write(b)
 }
@@ -227,6 +752,34 @@ func (i *Instance) SetConfig(cfg *Config) *Config {
 	return old
 }
 
+// UpdateConfig changes the config through f, safely even while Readline is
+// running in another goroutine. See Operation.UpdateConfig.
+func (i *Instance) UpdateConfig(f func(*Config)) error {
+	cfg, err := i.Operation.UpdateConfig(f)
+	if err != nil {
+		return err
+	}
+	i.Config = cfg
+	return nil
+}
+
 func (i *Instance) Refresh() {
 	i.Operation.Refresh()
 }
+
+// PrintInRegion writes b at the bottom of the scroll region set with
+// Terminal.SetScrollRegion, see Operation.PrintInRegion.
+func (i *Instance) PrintInRegion(b []byte) (int, error) {
+	return i.Operation.PrintInRegion(b)
+}
+
+// PrintAt replaces the content of row, see Operation.PrintAt.
+func (i *Instance) PrintAt(row int, s string) error {
+	return i.Operation.PrintAt(row, s)
+}
+
+// ForceRedraw repaints the prompt and line from scratch, see
+// Operation.ForceRedraw.
+func (i *Instance) ForceRedraw() {
+	i.Operation.ForceRedraw()
+}
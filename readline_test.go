@@ -1,6 +1,11 @@
 package rawterm
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -25,3 +30,113 @@ func TestRace(t *testing.T) {
 
 	rl.Readline()
 }
+
+func TestNewWithStreams(t *testing.T) {
+	in := bytes.NewBufferString("hello\r")
+	out := bytes.NewBuffer(nil)
+	rl, err := NewWithStreams(in, out, WithPrompt("> "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	line, err := rl.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello" {
+		t.Fatal("result not expect", line)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("> hello")) {
+		t.Fatalf("output not expect: %q", out.String())
+	}
+}
+
+func TestCloseStopsReadline(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, _ := newTestInstance(t, r)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rl.Close()
+	}()
+	if _, err := rl.Readline(); err != io.EOF {
+		t.Fatal("result not expect", err)
+	}
+
+	select {
+	case <-rl.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Closed() not closed")
+	}
+	if err := rl.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	r, w := io.Pipe()
+	rl, _ := newTestInstance(t, r)
+
+	done := make(chan struct{})
+	defer close(done)
+	loop := func(f func()) {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+					f()
+				}
+			}
+		}()
+	}
+	loop(func() { rl.SetPrompt("> ") })
+	loop(rl.Refresh)
+	loop(func() { fmt.Fprint(rl.Stdout(), "log\n") })
+	loop(func() { rl.UpdateConfig(func(c *Config) { c.Prompt = "$ " }) })
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			w.Write([]byte("abc\x02\x7f\x17"))
+		}
+		w.Write([]byte("done\r"))
+	}()
+	if _, err := rl.Readline(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadlineTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, _ := newTestInstance(t, r)
+
+	go w.Write([]byte("lost"))
+	if _, err := rl.ReadlineTimeout(20 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatal("result not expect", err)
+	}
+
+	go w.Write([]byte("kept\r"))
+	line, err := rl.ReadlineTimeout(time.Second)
+	if err != nil || line != "kept" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestNewLineReader(t *testing.T) {
+	lr := NewLineReader(strings.NewReader("a\r\nb\nc"))
+	var got []string
+	for {
+		line, err := lr.Readline()
+		if err != nil {
+			break
+		}
+		got = append(got, line)
+	}
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Fatal("result not expect", got)
+	}
+}
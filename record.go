@@ -0,0 +1,71 @@
+package rawterm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Config.RecordTo gets one line per key event read from the terminal:
+//
+//	<seconds since the first event> <modifiers> <rune>
+//
+// The time has millisecond precision, modifiers is the Modifier mask and
+// rune is the decimal value of KeyEvent.Rune, so named keys are negative.
+// Empty lines and lines starting with # are ignored by Replay. For example
+// "ab" followed by Alt+B and Enter:
+//
+//	0.000 0 97
+//	0.105 0 98
+//	0.820 2 98
+//	1.310 0 13
+
+// record logs ev to Config.RecordTo, called with o.m held.
+func (o *Operation) record(ev KeyEvent) {
+	w := o.cfg.RecordTo
+	if w == nil || ev.Rune == 0 {
+		return
+	}
+	now := time.Now()
+	if o.recordStart.IsZero() {
+		o.recordStart = now
+	}
+	fmt.Fprintf(w, "%.3f %d %d\n", now.Sub(o.recordStart).Seconds(), ev.Mod, ev.Rune)
+}
+
+// Replay feeds key events recorded with Config.RecordTo to the line editor
+// as if they were typed, keeping the recorded timing divided by speed. A
+// speed of 0 replays without delays. It returns once r is exhausted or
+// the operation is closed.
+func (o *Operation) Replay(r io.Reader, speed float64) error {
+	var last float64
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var at float64
+		var mod Modifier
+		var key rune
+		if _, err := fmt.Sscanf(line, "%f %d %d", &at, &mod, &key); err != nil {
+			return fmt.Errorf("replay line %d: %v", n, err)
+		}
+		if speed > 0 && at > last {
+			select {
+			case <-time.After(time.Duration((at - last) / speed * float64(time.Second))):
+			case <-o.exited:
+				return nil
+			}
+		}
+		last = at
+		select {
+		case o.replay <- KeyEvent{Rune: key, Mod: mod}:
+		case <-o.exited:
+			return nil
+		}
+	}
+	return s.Err()
+}
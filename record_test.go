@@ -0,0 +1,27 @@
+package rawterm
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	rec := bytes.NewBuffer(nil)
+	rl, _ := newTestInstance(t, strings.NewReader("ab\x1bbc\r"), WithRecordTo(rec))
+	line, err := rl.Readline()
+	rl.Close()
+	if err != nil || line != "cab" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	r, w := io.Pipe()
+	defer w.Close()
+	rl, _ = newTestInstance(t, r)
+	go rl.Replay(bytes.NewReader(rec.Bytes()), 0)
+	line, err = rl.Readline()
+	if err != nil || line != "cab" {
+		t.Fatal("result not expect", line, err, rec.String())
+	}
+}
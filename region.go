@@ -0,0 +1,97 @@
+package rawterm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SetScrollRegion limits scrolling to the rows top to bottom, counted from
+// 1, and leaves the rows around it alone, e.g. for a header or footer
+// printed with PrintAt. 0, 0 gives the whole screen back. The cursor
+// doesn't move.
+func (t *Terminal) SetScrollRegion(top, bottom int) error {
+	if top < 0 || bottom < 0 || (bottom > 0 && top >= bottom) ||
+		(bottom == 0 && top != 0) {
+		return errors.New("invalid scroll region")
+	}
+	t.m.Lock()
+	t.regionTop, t.regionBottom = top, bottom
+	f := t.onScrollRegion
+	t.m.Unlock()
+
+	if bottom == 0 {
+		io.WriteString(t, "\0337\033[r\0338")
+	} else {
+		fmt.Fprintf(t, "\0337\033[%d;%dr\0338", top, bottom)
+	}
+	if f != nil {
+		f(top, bottom)
+	}
+	return nil
+}
+
+// ScrollRegion returns the rows set by SetScrollRegion, 0, 0 if there is
+// none.
+func (t *Terminal) ScrollRegion() (top, bottom int) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.regionTop, t.regionBottom
+}
+
+// PrintInRegion writes b as whole lines at the bottom of the scroll region,
+// scrolling it up, and puts the cursor back where it was.
+func (t *Terminal) PrintInRegion(b []byte) (int, error) {
+	_, bottom := t.ScrollRegion()
+	if bottom == 0 {
+		return 0, errors.New("no scroll region")
+	}
+	if _, err := t.Write(regionLines(bottom, b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// PrintAt replaces the content of row with s, leaving the cursor where it
+// was. It's meant for rows outside of the scroll region.
+func (t *Terminal) PrintAt(row int, s string) error {
+	_, err := t.Write(rowContent(row, s))
+	return err
+}
+
+func regionLines(bottom int, b []byte) []byte {
+	out := []byte(fmt.Sprintf("\0337\033[%d;1H", bottom))
+	out = append(out, b...)
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, "\0338"...)
+}
+
+func rowContent(row int, s string) []byte {
+	return []byte(fmt.Sprintf("\0337\033[%d;1H\033[2K%s\0338", row, s))
+}
+
+// onScrollRegion keeps the line on a single row while the screen has a
+// scroll region which doesn't reach the last row. The prompt is likely
+// below it then, where a wrapped line would overwrite itself.
+func (o *Operation) onScrollRegion(top, bottom int) {
+	h := o.config().FuncGetHeight()
+	o.buf.SetSingleRow(bottom > 0 && (h <= 0 || bottom < h))
+}
+
+// PrintInRegion is Terminal.PrintInRegion which doesn't get in the way of
+// the line being repainted.
+func (o *Operation) PrintInRegion(b []byte) (int, error) {
+	o.buf.Lock()
+	defer o.buf.Unlock()
+	return o.t.PrintInRegion(b)
+}
+
+// PrintAt is Terminal.PrintAt which doesn't get in the way of the line
+// being repainted.
+func (o *Operation) PrintAt(row int, s string) error {
+	o.buf.Lock()
+	defer o.buf.Unlock()
+	return o.t.PrintAt(row, s)
+}
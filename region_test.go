@@ -0,0 +1,37 @@
+package rawterm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScrollRegion(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader(""))
+
+	if rl.Terminal.SetScrollRegion(5, 5) == nil {
+		t.Fatal("empty region accepted")
+	}
+	if err := rl.Terminal.SetScrollRegion(2, 22); err != nil {
+		t.Fatal(err)
+	}
+	if top, bottom := rl.Terminal.ScrollRegion(); top != 2 || bottom != 22 {
+		t.Fatal("region not expect", top, bottom)
+	}
+	if !rl.Operation.buf.scrolling() {
+		t.Fatal("line may wrap below the region")
+	}
+	rl.PrintAt(1, "header")
+	rl.PrintInRegion([]byte("log"))
+
+	want := "\0337\033[2;22r\0338" +
+		"\0337\033[1;1H\033[2Kheader\0338" +
+		"\0337\033[22;1Hlog\n\0338"
+	if s := out.String(); s != want {
+		t.Fatalf("output not expect %q", s)
+	}
+
+	rl.Terminal.SetScrollRegion(0, 0)
+	if rl.Operation.buf.scrolling() {
+		t.Fatal("line still kept on one row")
+	}
+}
@@ -0,0 +1,232 @@
+// Package repl is the read-eval-print loop most programs using rawterm
+// write, with commands looked up by their first word:
+//
+// 	err := repl.Run(repl.Config{
+// 		Prompt: "> ",
+// 		Commands: map[string]repl.Command{
+// 			"hello": {Help: "say hello", Run: func(args []string) error {
+// 				fmt.Println("hello", strings.Join(args, " "))
+// 				return nil
+// 			}},
+// 			"quit": {Help: "leave", Run: func([]string) error { return repl.ErrExit }},
+// 		},
+// 	})
+//
+// Ctrl-C drops the line being typed and Ctrl-D on an empty line leaves the
+// loop, Tab completes command names.
+package repl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/heppu/rawterm"
+)
+
+// ErrExit ends Run without an error when it's returned by a command.
+var ErrExit = errors.New("exit")
+
+// UnknownCommandError is returned for a line which doesn't start with a
+// command, Dispatch can return it too.
+type UnknownCommandError struct {
+	Name string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return "unknown command: " + e.Name
+}
+
+// Command is run with the words of the line after its name, they're split
+// with rawterm.SplitArgs so quotes work as in a shell.
+type Command struct {
+	Help string
+	Run  func(args []string) error
+}
+
+// Config describes the loop.
+type Config struct {
+	Prompt string
+	// looked up by the first word of a line. Unless there's one named
+	// "help" it lists the commands.
+	Commands map[string]Command
+	// gets the lines which don't start with a command, nil reports them as
+	// unknown
+	Dispatch func(line string) error
+	// gets the errors of commands and Dispatch, nil prints them to Stderr
+	OnError func(err error)
+	// picks the commands Tab completes to, rawterm.MatchPrefix if nil
+	Matcher rawterm.Matcher
+	// for an unknown command ask "did you mean" with the closest command
+	// name, the line can be run with it, edited first or dropped
+	Correct bool
+
+	// the config of the line editor, a default one is used if nil
+	Readline *rawterm.Config
+	// use this Instance instead of making one, it isn't closed by Run
+	Instance *rawterm.Instance
+}
+
+// Run reads and runs lines until Ctrl-D, or a command returns ErrExit.
+// It returns nil then, or the error reading a line.
+func Run(cfg Config) error {
+	rl := cfg.Instance
+	if rl == nil {
+		rc := cfg.Readline
+		if rc == nil {
+			rc = &rawterm.Config{}
+		}
+		var err error
+		if rl, err = rawterm.NewEx(rc); err != nil {
+			return err
+		}
+		defer rl.Close()
+	}
+	if cfg.Prompt != "" {
+		rl.SetPrompt(cfg.Prompt)
+	}
+	if len(cfg.Commands) > 0 {
+		rl.UpdateConfig(func(c *rawterm.Config) {
+			// a copy, the caller's map is left alone
+			bindings := map[rawterm.KeyEvent]rawterm.KeyHandler{}
+			for k, h := range c.KeyBindings {
+				bindings[k] = h
+			}
+			c.KeyBindings = bindings
+			c.Bind(rawterm.KeyEvent{Rune: rawterm.CharTab}, cfg.complete)
+		})
+	}
+
+	for {
+		line, err := rl.Readline()
+		switch {
+		case err == rawterm.ErrInterrupt:
+			continue
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		err = cfg.run(rl, line)
+		var unknown *UnknownCommandError
+		if cfg.Correct && errors.As(err, &unknown) {
+			if fixed, ok := cfg.correct(rl, line, unknown.Name); ok {
+				err = cfg.run(rl, fixed)
+			}
+		}
+		if err == ErrExit {
+			return nil
+		} else if err != nil {
+			if cfg.OnError != nil {
+				cfg.OnError(err)
+			} else {
+				theme := rl.Config.ActiveTheme()
+				fmt.Fprintln(rl.Stderr(), theme.Paint(theme.Error, err.Error()))
+			}
+		}
+	}
+}
+
+func (cfg *Config) run(rl *rawterm.Instance, line string) error {
+	words, err := rawterm.SplitArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	if c, ok := cfg.Commands[words[0]]; ok {
+		return c.Run(words[1:])
+	}
+	if words[0] == "help" && len(cfg.Commands) > 0 {
+		// paged if it doesn't fit on the screen
+		var buf bytes.Buffer
+		cfg.help(&buf)
+		return rl.Page(&buf)
+	}
+	if cfg.Dispatch != nil {
+		return cfg.Dispatch(line)
+	}
+	return &UnknownCommandError{words[0]}
+}
+
+// correct asks whether to run line with the command name closest to the
+// unknown one, or to edit it first. ok is false if there's no close name
+// or the answer was no.
+func (cfg *Config) correct(rl *rawterm.Instance, line, name string) (fixed string, ok bool) {
+	names := rawterm.Suggest(name, cfg.names(), 2)
+	if len(names) == 0 {
+		return "", false
+	}
+	fixed = strings.Replace(line, name, names[0], 1)
+	theme := rl.Config.ActiveTheme()
+	question := fmt.Sprintf("did you mean %s? [y/n/e] ", theme.Paint(theme.Suggestion, names[0]))
+	answer, err := rl.ReadlineOpts(rawterm.ReadPrompt(question))
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return fixed, true
+	case "e", "edit":
+		fixed, err = rl.ReadlineOpts(rawterm.ReadDefault(fixed))
+		return fixed, err == nil
+	}
+	return "", false
+}
+
+func (cfg *Config) names() []string {
+	names := make([]string, 0, len(cfg.Commands))
+	for name := range cfg.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cfg *Config) help(w io.Writer) {
+	width := 0
+	for name := range cfg.Commands {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, name := range cfg.names() {
+		fmt.Fprintf(w, "%-*s  %s\n", width, name, cfg.Commands[name].Help)
+	}
+}
+
+// complete completes the command name before the cursor, what the names
+// have in common if several match.
+func (cfg *Config) complete(line []rune, pos int, key rawterm.KeyEvent) ([]rune, int, bool) {
+	word, start := rawterm.WordAt(line, pos)
+	if strings.TrimSpace(string(line[:start])) != "" {
+		// not the first word
+		return nil, 0, false
+	}
+	m := cfg.Matcher
+	if m == nil {
+		m = rawterm.MatchPrefix
+	}
+	names := rawterm.MatchAll(m, string(word), cfg.names())
+	if len(names) == 0 {
+		return nil, 0, false
+	}
+	common := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	repl := []rune(common)
+	if len(names) == 1 {
+		repl = append(repl, ' ')
+	} else if len(repl) <= len(word) {
+		return nil, 0, false
+	}
+	newLine := append(append(append([]rune(nil), line[:start]...), repl...), line[pos:]...)
+	return newLine, start + len(repl), true
+}
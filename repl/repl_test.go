@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/heppu/rawterm"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	in := "hel\tthere 'you all'\rbroken\rabc\x03bogus\rhelp\rquit\rhello\r"
+	rl, err := rawterm.NewWithStreams(strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	var said []string
+	var errs []string
+	err = Run(Config{
+		Instance: rl,
+		Commands: map[string]Command{
+			"hello": {Help: "say hello", Run: func(args []string) error {
+				said = append(said, strings.Join(args, "+"))
+				return nil
+			}},
+			"broken": {Run: func([]string) error { return errors.New("it broke") }},
+			"quit":   {Help: "leave", Run: func([]string) error { return ErrExit }},
+		},
+		OnError: func(err error) { errs = append(errs, err.Error()) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(said, ",") != "there+you all" {
+		t.Fatal("commands not expect", said)
+	}
+	if strings.Join(errs, ",") != "it broke,unknown command: bogus" {
+		t.Fatal("errors not expect", errs)
+	}
+	if !strings.Contains(out.String(), "hello   say hello") {
+		t.Fatalf("help not expect: %q", out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	cfg := Config{Commands: map[string]Command{"status": {}, "stash": {}, "show": {}}}
+	for _, c := range []struct {
+		m          rawterm.Matcher
+		line, want string
+	}{
+		{nil, "st", "sta"},
+		{nil, "sh", "show "},
+		{nil, "x", "x"},
+		{rawterm.MatchIgnoreCase, "STATU", "status "},
+		{rawterm.MatchFuzzy, "sw", "show "},
+	} {
+		cfg.Matcher = c.m
+		line := []rune(c.line)
+		got, _, ok := cfg.complete(line, len(line), rawterm.KeyEvent{})
+		if !ok {
+			got = line
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: got %q, want %q", c.line, string(got), c.want)
+		}
+	}
+}
+
+func TestCorrect(t *testing.T) {
+	in := "hellp a\ry\rhelo b\rn\rhrllo c\re\r\rquit\rhello\r"
+	rl, err := rawterm.NewWithStreams(strings.NewReader(in), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	var said, errs []string
+	err = Run(Config{
+		Instance: rl,
+		Commands: map[string]Command{
+			"hello": {Run: func(args []string) error {
+				said = append(said, strings.Join(args, "+"))
+				return nil
+			}},
+			"quit": {Run: func([]string) error { return ErrExit }},
+		},
+		OnError: func(err error) { errs = append(errs, err.Error()) },
+		Correct: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(said, ",") != "a,c" || strings.Join(errs, ",") != "unknown command: helo" {
+		t.Fatal("result not expect", said, errs)
+	}
+}
@@ -3,9 +3,11 @@ package rawterm
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type runeBufferBck struct {
@@ -18,17 +20,37 @@ type RuneBuffer struct {
 	idx    int
 	prompt []rune
 	w      io.Writer
+	// computes the prompt each time the line is drawn, see PromptTemplate
+	promptFunc func() string
 
 	hadClean    bool
 	interactive bool
 	cfg         *Config
-
-	width int
+	mask        rune
+	// mask the line even if Config.EnableMask is off, for one read
+	maskOn bool
+	// the masked rune at revealIdx is shown as it is, see MaskRevealDelay
+	revealed  bool
+	revealIdx int
+	// shown after the line until the next key, e.g. why input was refused
+	hint []rune
+	// the hint is an error, see Theme.Error
+	hintErr bool
+
+	width  int
+	height int
+	// first rune shown when the line is scrolled, see HorizontalScroll
+	scroll int
+	// scroll even without HorizontalScroll, see Terminal.SetScrollRegion
+	singleRow bool
 
 	bck *runeBufferBck
 
 	offset string
 
+	// counts the calls of Refresh, see Stats
+	refreshes int64
+
 	sync.Mutex
 }
 
@@ -38,6 +60,21 @@ func (r *RuneBuffer) OnWidthChange(newWidth int) {
 	r.Unlock()
 }
 
+// OnSizeChange is OnWidthChange which also knows the height, <= 0 if it's
+// unknown.
+func (r *RuneBuffer) OnSizeChange(width, height int) {
+	r.Lock()
+	r.width, r.height = width, height
+	r.Unlock()
+}
+
+// Size returns the terminal size the line is drawn for.
+func (r *RuneBuffer) Size() (width, height int) {
+	r.Lock()
+	defer r.Unlock()
+	return r.width, r.height
+}
+
 func (r *RuneBuffer) Backup() {
 	r.Lock()
 	r.bck = &runeBufferBck{r.buf, r.idx}
@@ -59,6 +96,7 @@ func NewRuneBuffer(w io.Writer, prompt string, cfg *Config, width int) *RuneBuff
 		w:           w,
 		interactive: cfg.useInteractive(),
 		cfg:         cfg,
+		mask:        cfg.MaskRune,
 		width:       width,
 	}
 	rb.SetPrompt(prompt)
@@ -74,14 +112,74 @@ func (r *RuneBuffer) SetConfig(cfg *Config) {
 
 func (r *RuneBuffer) SetMask(m rune) {
 	r.Lock()
-	r.cfg.MaskRune = m
+	r.mask = m
+	r.Unlock()
+}
+
+// setMaskOn masks the line with m regardless of Config.EnableMask, or
+// goes back to the config if on is false. It returns the previous state.
+func (r *RuneBuffer) setMaskOn(on bool, m rune) (wasOn bool, old rune) {
+	r.Lock()
+	wasOn, old = r.maskOn, r.mask
+	r.maskOn, r.mask = on, m
+	r.Unlock()
+	return
+}
+
+// Reveal shows the masked rune at idx until HideReveal is called.
+func (r *RuneBuffer) Reveal(idx int) {
+	r.Refresh(func() {
+		r.revealed, r.revealIdx = true, idx
+	})
+}
+
+// HideReveal masks the rune shown by Reveal again.
+func (r *RuneBuffer) HideReveal() {
+	r.Lock()
+	revealed := r.revealed
+	r.Unlock()
+	if revealed {
+		r.Refresh(func() {
+			r.revealed = false
+		})
+	}
+}
+
+// SetHint shows s after the line until it's called with "".
+func (r *RuneBuffer) SetHint(s string) {
+	r.setHint(s, false)
+}
+
+// SetErrorHint is SetHint in the Error color of the Theme.
+func (r *RuneBuffer) SetErrorHint(s string) {
+	r.setHint(s, true)
+}
+
+func (r *RuneBuffer) setHint(s string, isErr bool) {
+	r.Lock()
+	same := string(r.hint) == s && r.hintErr == isErr
 	r.Unlock()
+	if !same {
+		r.Refresh(func() {
+			r.hint, r.hintErr = []rune(s), isErr
+		})
+	}
+}
+
+func (r *RuneBuffer) isMasked() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.masked()
+}
+
+func (r *RuneBuffer) masked() bool {
+	return r.cfg.EnableMask || r.maskOn
 }
 
 func (r *RuneBuffer) CurrentWidth(x int) int {
 	r.Lock()
 	defer r.Unlock()
-	return runes.WidthAll(r.buf[:x])
+	return r.widthAll(r.buf[:x])
 }
 
 func (r *RuneBuffer) PromptLen() int {
@@ -91,8 +189,38 @@ func (r *RuneBuffer) PromptLen() int {
 	return width
 }
 
+// promptLen is the width of the prompt's last row, the one the line
+// starts on.
 func (r *RuneBuffer) promptLen() int {
-	return runes.WidthAll(runes.ColorFilter(r.prompt))
+	return runes.WidthAll(runes.ColorFilter(r.promptTail()))
+}
+
+func (r *RuneBuffer) promptTail() []rune {
+	for i := len(r.prompt) - 1; i >= 0; i-- {
+		if r.prompt[i] == '\n' {
+			return r.prompt[i+1:]
+		}
+	}
+	return r.prompt
+}
+
+// promptRows counts the rows a multi-line prompt takes above the row the
+// line starts on.
+func (r *RuneBuffer) promptRows(width int) int {
+	rows, start := 0, 0
+	for i, c := range r.prompt {
+		if c != '\n' {
+			continue
+		}
+		w := runes.WidthAll(runes.ColorFilter(r.prompt[start:i]))
+		if width > 0 && w > 0 {
+			rows += LineCount(width, w)
+		} else {
+			rows++
+		}
+		start = i + 1
+	}
+	return rows
 }
 
 func (r *RuneBuffer) RuneSlice(i int) []rune {
@@ -157,8 +285,10 @@ func (r *RuneBuffer) WriteRune(s rune) {
 
 func (r *RuneBuffer) WriteRunes(s []rune) {
 	r.Refresh(func() {
-		tail := append(s, r.buf[r.idx:]...)
-		r.buf = append(r.buf[:r.idx], tail...)
+		// insert in place, a long line isn't copied for each key
+		r.buf = append(r.buf, s...)
+		copy(r.buf[r.idx+len(s):], r.buf[r.idx:])
+		copy(r.buf[r.idx:], s)
 		r.idx += len(s)
 	})
 }
@@ -203,22 +333,22 @@ func (r *RuneBuffer) Delete() (success bool) {
 }
 
 func (r *RuneBuffer) DeleteWord() {
-	if r.idx == len(r.buf) {
-		return
-	}
-	init := r.idx
-	for init < len(r.buf) && IsWordBreak(r.buf[init]) {
-		init++
-	}
-	for i := init + 1; i < len(r.buf); i++ {
-		if !IsWordBreak(r.buf[i]) && IsWordBreak(r.buf[i-1]) {
-			r.Refresh(func() {
-				r.buf = append(r.buf[:r.idx], r.buf[i-1:]...)
-			})
+	r.Refresh(func() {
+		if r.idx == len(r.buf) {
 			return
 		}
-	}
-	r.Kill()
+		init := r.idx
+		for init < len(r.buf) && IsWordBreak(r.buf[init]) {
+			init++
+		}
+		for i := init + 1; i < len(r.buf); i++ {
+			if !IsWordBreak(r.buf[i]) && IsWordBreak(r.buf[i-1]) {
+				r.buf = append(r.buf[:r.idx], r.buf[i-1:]...)
+				return
+			}
+		}
+		r.buf = r.buf[:r.idx]
+	})
 }
 
 func (r *RuneBuffer) MoveToPrevWord() (success bool) {
@@ -354,11 +484,23 @@ func (r *RuneBuffer) MoveToLineEnd() {
 }
 
 func (r *RuneBuffer) LineCount(width int) int {
+	r.Lock()
+	defer r.Unlock()
 	if width == -1 {
 		width = r.width
 	}
+	if r.scrolling() {
+		return 1 + r.promptRows(width)
+	}
+	if r.wordWrap() {
+		rows := r.wordRows()
+		if len(rows) > 1 && len(rows[len(rows)-1]) == 0 {
+			rows = rows[:len(rows)-1]
+		}
+		return len(rows) + r.promptRows(width)
+	}
 	return LineCount(width,
-		runes.WidthAll(r.buf)+r.PromptLen())
+		r.widthAll(r.buf)+r.promptLen()) + r.promptRows(width)
 }
 
 func (r *RuneBuffer) MoveTo(ch rune, prevChar, reverse bool) (success bool) {
@@ -398,8 +540,67 @@ func (r *RuneBuffer) isInLineEdge() bool {
 	return len(sp[len(sp)-1]) == 0
 }
 
+// getSplitByLine splits rs into the rows it's drawn on, rs has to be r.buf
+// or the part of it before the cursor.
 func (r *RuneBuffer) getSplitByLine(rs []rune) []string {
-	return SplitByLine(r.promptLen(), r.width, rs)
+	if r.wordWrap() {
+		return r.wordSplit(len(rs))
+	}
+	return splitByLine(r.promptLen(), r.width, rs, r.runeWidth)
+}
+
+func (r *RuneBuffer) wordWrap() bool {
+	return r.cfg.WordWrap && r.width > 0 && !r.masked()
+}
+
+// wordRows splits the line into rows without breaking words, unless a word
+// is longer than a row. The rows are padded with blanks when drawn. If the
+// last row is full an empty one follows, where the cursor goes.
+func (r *RuneBuffer) wordRows() [][]rune {
+	var rows [][]rune
+	start, col, brk := 0, r.promptLen(), -1
+	for i, c := range r.buf {
+		w := r.runeWidth(c)
+		if col+w > r.width {
+			end := i
+			if brk > start && !(col == r.width && c == ' ') {
+				end = brk
+			}
+			rows = append(rows, r.buf[start:end])
+			start, col, brk = end, r.widthAll(r.buf[end:i]), -1
+		}
+		col += w
+		if c == ' ' {
+			brk = i + 1
+		}
+	}
+	rows = append(rows, r.buf[start:])
+	if col >= r.width {
+		rows = append(rows, nil)
+	}
+	return rows
+}
+
+// wordSplit is getSplitByLine for the first n runes with WordWrap.
+func (r *RuneBuffer) wordSplit(n int) []string {
+	rows := r.wordRows()
+	var ret []string
+	for i, row := range rows {
+		full := r.rowWidth(i, row) >= r.width && i < len(rows)-1
+		if n < len(row) || (n == len(row) && !full) {
+			return append(ret, string(row[:n]))
+		}
+		ret = append(ret, string(row))
+		n -= len(row)
+	}
+	return ret
+}
+
+func (r *RuneBuffer) rowWidth(i int, row []rune) int {
+	if i == 0 {
+		return r.promptLen() + r.widthAll(row)
+	}
+	return r.widthAll(row)
 }
 
 func (r *RuneBuffer) IdxLine(width int) int {
@@ -412,8 +613,11 @@ func (r *RuneBuffer) idxLine(width int) int {
 	if width == 0 {
 		return 0
 	}
+	if r.scrolling() {
+		return r.promptRows(width)
+	}
 	sp := r.getSplitByLine(r.buf[:r.idx])
-	return len(sp) - 1
+	return len(sp) - 1 + r.promptRows(width)
 }
 
 func (r *RuneBuffer) CursorLineCount() int {
@@ -421,6 +625,7 @@ func (r *RuneBuffer) CursorLineCount() int {
 }
 
 func (r *RuneBuffer) Refresh(f func()) {
+	atomic.AddInt64(&r.refreshes, 1)
 	r.Lock()
 	defer r.Unlock()
 
@@ -431,13 +636,221 @@ func (r *RuneBuffer) Refresh(f func()) {
 		return
 	}
 
+	prompt := r.prompt
+	if r.promptFunc != nil {
+		prompt = []rune(r.promptFunc())
+	}
+	if f != nil && r.cfg.LowBandwidth && !r.hadClean && runes.Equal(prompt, r.prompt) {
+		r.refreshDiff(f)
+		return
+	}
+
+	// keep the cursor from jumping around while the line is repainted
+	if r.hidesCursor() {
+		r.w.Write([]byte(cursorHide))
+		defer r.w.Write([]byte(cursorShow))
+	}
+
 	r.clean()
+	r.prompt = prompt
 	if f != nil {
 		f()
 	}
 	r.print()
 }
 
+// hidesCursor reports whether the cursor is hidden while the line is
+// painted, it's left alone if Terminal.HideCursor turned it off.
+func (r *RuneBuffer) hidesCursor() bool {
+	if r.cfg.DisableHideCursor {
+		return false
+	}
+	t, ok := r.w.(*Terminal)
+	return !ok || atomic.LoadInt32(&t.cursorHidden) == 0
+}
+
+// Redraw paints the line again from the start of the cursor's row without
+// erasing where it was, for when the screen changed behind its back.
+func (r *RuneBuffer) Redraw() {
+	r.Lock()
+	defer r.Unlock()
+	if !r.interactive {
+		return
+	}
+	if r.promptFunc != nil {
+		r.prompt = []rune(r.promptFunc())
+	}
+	if r.hidesCursor() {
+		r.w.Write([]byte(cursorHide))
+		defer r.w.Write([]byte(cursorShow))
+	}
+	// the rows of a multi-line prompt are above the cursor
+	if n := r.promptRows(r.width); n > 0 {
+		fmt.Fprintf(r.w, "\033[%dA", n)
+	}
+	r.w.Write([]byte("\r\033[J"))
+	r.print()
+}
+
+// refreshDiff applies f and updates the screen by only rewriting the line
+// from the first changed rune, using nothing but backspaces to move. Anything
+// which can't be done within a single row falls back to a full repaint.
+func (r *RuneBuffer) refreshDiff(f func()) {
+	old := runes.Copy(r.buf)
+	oldIdx := r.idx
+	oldHint := len(r.hint) > 0
+	idxLine := r.idxLine(r.width)
+	f()
+
+	if r.masked() || r.cfg.HighlightMatchingBracket || oldHint || len(r.hint) > 0 ||
+		!r.fitsInRow(old) || !r.fitsInRow(r.buf) {
+		r.cleanWithIdxLine(idxLine)
+		r.print()
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if runes.Equal(old, r.buf) {
+		if r.idx < oldIdx {
+			buf.Write(r.backspace(old[r.idx:oldIdx]))
+		} else {
+			r.writeRunes(buf, old[oldIdx:r.idx])
+		}
+		r.w.Write(buf.Bytes())
+		return
+	}
+
+	start := 0
+	for start < len(old) && start < len(r.buf) && old[start] == r.buf[start] {
+		start++
+	}
+	if start > r.idx {
+		start = r.idx
+	}
+
+	if oldIdx > start {
+		buf.Write(r.backspace(old[start:oldIdx]))
+	} else {
+		r.writeRunes(buf, old[oldIdx:start])
+	}
+	tail := r.buf[start:]
+	r.writeRunes(buf, tail)
+	erased := r.widthAll(old[start:]) - r.widthAll(tail)
+	if erased > 0 {
+		buf.WriteString(strings.Repeat(" ", erased))
+		buf.WriteString(strings.Repeat("\b", erased))
+	}
+	buf.Write(r.backspace(r.buf[r.idx:]))
+	r.w.Write(buf.Bytes())
+}
+
+func (r *RuneBuffer) fitsInRow(rs []rune) bool {
+	return r.width > 0 && r.promptLen()+r.widthAll(rs) < r.width
+}
+
+const (
+	bracketHighlight    = "\033[1m"
+	bracketHighlightEnd = "\033[22m"
+)
+
+var bracketPairs = map[rune]rune{')': '(', ']': '[', '}': '{'}
+
+// matchingBracket returns the index of the opener matching the closing
+// bracket or quote under or before the cursor if HighlightMatchingBracket
+// is set, -1 otherwise.
+func (r *RuneBuffer) matchingBracket() int {
+	if !r.cfg.HighlightMatchingBracket {
+		return -1
+	}
+	for _, i := range []int{r.idx, r.idx - 1} {
+		if i < 0 || i >= len(r.buf) {
+			continue
+		}
+		if m := matchOpener(r.buf, i); m >= 0 {
+			return m
+		}
+	}
+	return -1
+}
+
+// matchOpener finds the opener of the bracket or quote at rs[i].
+func matchOpener(rs []rune, i int) int {
+	closer := rs[i]
+	switch closer {
+	case '"', '\'', '`':
+		// a closing quote is one preceded by an odd number of them
+		n, last := 0, -1
+		for j := 0; j < i; j++ {
+			if rs[j] == closer {
+				n++
+				last = j
+			}
+		}
+		if n%2 == 1 {
+			return last
+		}
+		return -1
+	}
+	opener, ok := bracketPairs[closer]
+	if !ok {
+		return -1
+	}
+	depth := 0
+	for j := i - 1; j >= 0; j-- {
+		switch rs[j] {
+		case closer:
+			depth++
+		case opener:
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func (r *RuneBuffer) tabWidth() int {
+	switch {
+	case r.cfg.TabAsCaret:
+		return 2
+	case r.cfg.TabWidth > 0:
+		return r.cfg.TabWidth
+	}
+	return TabWidth
+}
+
+// runeWidth is runes.Width with tabs as wide as they are drawn.
+func (r *RuneBuffer) runeWidth(c rune) int {
+	if c == '\t' {
+		return r.tabWidth()
+	}
+	return runes.Width(c)
+}
+
+func (r *RuneBuffer) widthAll(rs []rune) (width int) {
+	for _, c := range rs {
+		width += r.runeWidth(c)
+	}
+	return width
+}
+
+func (r *RuneBuffer) backspace(rs []rune) []byte {
+	return bytes.Repeat([]byte{'\b'}, r.widthAll(rs))
+}
+
+func (r *RuneBuffer) writeRunes(buf *bytes.Buffer, rs []rune) {
+	for _, c := range rs {
+		if c == '\t' && r.cfg.TabAsCaret {
+			buf.WriteString("^I")
+		} else if c == '\t' {
+			buf.WriteString(strings.Repeat(" ", r.tabWidth()))
+		} else {
+			buf.WriteRune(c)
+		}
+	}
+}
+
 func (r *RuneBuffer) SetOffset(offset string) {
 	r.Lock()
 	r.offset = offset
@@ -451,49 +864,196 @@ func (r *RuneBuffer) print() {
 
 func (r *RuneBuffer) output() []byte {
 	buf := bytes.NewBuffer(nil)
-	buf.WriteString(string(r.prompt))
-	if r.cfg.EnableMask && len(r.buf) > 0 {
-		buf.Write([]byte(strings.Repeat(string(r.cfg.MaskRune), len(r.buf)-1)))
-		if r.buf[len(r.buf)-1] == '\n' {
-			buf.Write([]byte{'\n'})
-		} else {
-			buf.Write([]byte(string(r.cfg.MaskRune)))
+	theme := r.cfg.ActiveTheme()
+	buf.WriteString(theme.Paint(theme.Prompt, string(r.prompt)))
+	if r.scrolling() {
+		r.scrollOutput(buf)
+		return buf.Bytes()
+	}
+	if r.masked() && len(r.buf) > 0 {
+		for i, c := range r.buf {
+			switch {
+			case i == len(r.buf)-1 && c == '\n':
+				buf.WriteByte('\n')
+			case r.revealed && i == r.revealIdx:
+				buf.WriteRune(c)
+			default:
+				buf.WriteRune(r.mask)
+			}
 		}
-		if len(r.buf) > r.idx {
-			buf.Write(runes.Backspace(r.buf[r.idx:]))
+		if r.isInLineEdge() {
+			buf.Write([]byte(" \b"))
 		}
-
 	} else {
-		for idx := range r.buf {
-			if r.buf[idx] == '\t' {
-				buf.WriteString(strings.Repeat(" ", TabWidth))
-			} else {
-				buf.WriteRune(r.buf[idx])
-			}
-		}
+		r.writeLine(buf, r.matchingBracket(), theme.Selection)
 		if r.isInLineEdge() {
 			buf.Write([]byte(" \b"))
 		}
 	}
 
-	if len(r.buf) > r.idx {
-		buf.Write(runes.Backspace(r.buf[r.idx:]))
+	// only shown if it fits, the line's height mustn't change
+	if hint := runes.ColorFilter(r.hint); len(hint) > 0 && r.fitsInRow(append(runes.Copy(r.buf), hint...)) {
+		style := theme.Hint
+		if r.hintErr {
+			style = theme.Error
+		}
+		buf.WriteString(theme.Paint(style, string(r.hint)))
+		buf.Write(r.backspace(hint))
 	}
+
+	r.moveBack(buf)
 	return buf.Bytes()
 }
 
+// writeLine writes the line with the rune at m highlighted, if m >= 0, in
+// bold or the given SGR style.
+func (r *RuneBuffer) writeLine(buf *bytes.Buffer, m int, style string) {
+	on, off := bracketHighlight, bracketHighlightEnd
+	if style != "" {
+		on, off = "\033["+style+"m", "\033[0m"
+	}
+	rows := [][]rune{r.buf}
+	if r.wordWrap() {
+		rows = r.wordRows()
+	}
+	i := 0
+	for n, row := range rows {
+		for _, c := range row {
+			if i == m {
+				buf.WriteString(on)
+			}
+			r.writeRunes(buf, []rune{c})
+			if i == m {
+				buf.WriteString(off)
+			}
+			i++
+		}
+		if n < len(rows)-1 {
+			if pad := r.width - r.rowWidth(n, row); pad > 0 {
+				buf.WriteString(strings.Repeat(" ", pad))
+			}
+		}
+	}
+}
+
+// moveBack moves the cursor from the end of the line to r.idx. A line on
+// more than one row is gone through with relative moves to the start of
+// the cursor's row, since a backspace doesn't go up a row and the line may
+// have made the screen scroll.
+func (r *RuneBuffer) moveBack(buf *bytes.Buffer) {
+	if r.idx == len(r.buf) {
+		return
+	}
+	if r.width <= 0 || r.fitsInRow(r.buf) {
+		buf.Write(r.backspace(r.buf[r.idx:]))
+		return
+	}
+	end := r.getSplitByLine(r.buf)
+	cur := r.getSplitByLine(r.buf[:r.idx])
+	if up := len(end) - len(cur); up > 0 {
+		fmt.Fprintf(buf, "\033[%dA", up)
+	}
+	col := r.widthAll([]rune(cur[len(cur)-1]))
+	if len(cur) == 1 {
+		col += r.promptLen()
+	}
+	buf.WriteByte('\r')
+	if col > 0 {
+		fmt.Fprintf(buf, "\033[%dC", col)
+	}
+}
+
+func (r *RuneBuffer) scrolling() bool {
+	// there must be room for both markers and at least a rune
+	return (r.cfg.HorizontalScroll || r.singleRow) && r.width > r.promptLen()+3
+}
+
+// SetSingleRow keeps the line on one row and scrolls it sideways like
+// HorizontalScroll does.
+func (r *RuneBuffer) SetSingleRow(on bool) {
+	r.Lock()
+	r.singleRow = on
+	r.Unlock()
+}
+
+// scrollWindow returns the part of the line which fits after the prompt,
+// moving it only as far as needed to keep the cursor in view.
+func (r *RuneBuffer) scrollWindow() (start, end int) {
+	avail := r.width - r.promptLen() - 1
+	left := func(start int) int {
+		if start > 0 {
+			return 1
+		}
+		return 0
+	}
+	if r.scroll > r.idx {
+		r.scroll = r.idx
+	}
+	// the rune under the cursor must show, followed by the '>' if needed
+	under := 0
+	if r.idx < len(r.buf) {
+		under = r.runeWidth(r.buf[r.idx])
+		if r.idx+1 < len(r.buf) {
+			under++
+		}
+	}
+	for r.scroll < r.idx && left(r.scroll)+r.widthAll(r.buf[r.scroll:r.idx])+under > avail {
+		r.scroll++
+	}
+	// don't leave room unused at the end when the line got shorter
+	for r.scroll > 0 && left(r.scroll-1)+r.widthAll(r.buf[r.scroll-1:]) <= avail {
+		r.scroll--
+	}
+
+	end = r.scroll
+	used := left(r.scroll)
+	for end < len(r.buf) {
+		more := 0
+		if end+1 < len(r.buf) {
+			more = 1
+		}
+		w := r.runeWidth(r.buf[end])
+		if used+w+more > avail {
+			break
+		}
+		used += w
+		end++
+	}
+	return r.scroll, end
+}
+
+func (r *RuneBuffer) scrollOutput(buf *bytes.Buffer) {
+	start, end := r.scrollWindow()
+	shown := r.buf[start:end]
+	if r.masked() {
+		shown = []rune(strings.Repeat(string(r.mask), len(shown)))
+	}
+	if start > 0 {
+		buf.WriteByte('<')
+	}
+	r.writeRunes(buf, shown)
+	if end < len(r.buf) {
+		buf.WriteString(">\b")
+	}
+	buf.Write(r.backspace(shown[r.idx-start:]))
+}
+
 func (r *RuneBuffer) Reset() []rune {
+	r.Lock()
+	defer r.Unlock()
 	ret := runes.Copy(r.buf)
 	r.buf = r.buf[:0]
 	r.idx = 0
+	r.scroll = 0
+	r.revealed = false
 	return ret
 }
 
 func (r *RuneBuffer) calWidth(m int) int {
 	if m > 0 {
-		return runes.WidthAll(r.buf[r.idx : r.idx+m])
+		return r.widthAll(r.buf[r.idx : r.idx+m])
 	}
-	return runes.WidthAll(r.buf[r.idx+m : r.idx])
+	return r.widthAll(r.buf[r.idx+m : r.idx])
 }
 
 func (r *RuneBuffer) SetStyle(start, end int, style string) {
@@ -531,11 +1091,25 @@ func (r *RuneBuffer) SetPrompt(prompt string) {
 	r.Unlock()
 }
 
+func (r *RuneBuffer) Prompt() string {
+	r.Lock()
+	defer r.Unlock()
+	return string(r.prompt)
+}
+
+// SetPromptFunc makes the buffer ask f for the prompt whenever it's
+// refreshed, nil goes back to the prompt set by SetPrompt.
+func (r *RuneBuffer) SetPromptFunc(f func() string) {
+	r.Lock()
+	r.promptFunc = f
+	r.Unlock()
+}
+
 func (r *RuneBuffer) cleanOutput(w io.Writer, idxLine int) {
 	buf := bufio.NewWriter(w)
 
 	if r.width == 0 {
-		buf.WriteString(strings.Repeat("\r\b", len(r.buf)+r.promptLen()))
+		buf.WriteString(strings.Repeat("\r\b", len(r.buf)+runes.WidthAll(runes.ColorFilter(r.prompt))))
 		buf.Write([]byte("\033[J"))
 	} else {
 		// TODO: Config option for this
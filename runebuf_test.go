@@ -0,0 +1,290 @@
+package rawterm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLowBandwidthRefresh(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	cfg := &Config{ForceUseInteractive: true, LowBandwidth: true}
+	rb := NewRuneBuffer(w, "> ", cfg, 80)
+	rb.Refresh(nil)
+
+	w.Reset()
+	rb.WriteString("ab")
+	if w.String() != "ab" {
+		t.Fatalf("typing: %q", w.String())
+	}
+
+	w.Reset()
+	rb.MoveBackward()
+	rb.WriteRune('x')
+	if w.String() != "\bxb\b" {
+		t.Fatalf("insert: %q", w.String())
+	}
+
+	w.Reset()
+	rb.Backspace()
+	if w.String() != "\bb \b\b" {
+		t.Fatalf("backspace: %q", w.String())
+	}
+	if string(rb.Runes()) != "ab" || rb.Pos() != 1 {
+		t.Fatal("result not expect", string(rb.Runes()), rb.Pos())
+	}
+}
+
+func TestMatchingBracket(t *testing.T) {
+	for _, c := range []struct {
+		line   string
+		idx    int
+		expect int
+	}{
+		{"f(a[1], (b))", 12, 1},
+		{"f(a[1], (b))", 10, 8},
+		{"f(a[1], (b))", 6, 3},
+		{"f(a[1], (b))", 3, -1},
+		{`say "hi" x`, 8, 4},
+		{`say "hi`, 7, -1},
+	} {
+		rb := NewRuneBuffer(bytes.NewBuffer(nil), "", &Config{ForceUseInteractive: true, HighlightMatchingBracket: true}, 80)
+		rb.buf, rb.idx = []rune(c.line), c.idx
+		if m := rb.matchingBracket(); m != c.expect {
+			t.Fatal("result not expect", c.line, c.idx, m)
+		}
+	}
+}
+
+func TestRedraw(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	cfg := &Config{ForceUseInteractive: true, DisableHideCursor: true}
+	rb := NewRuneBuffer(w, "> ", cfg, 80)
+	rb.WriteString("abc")
+	rb.MoveBackward()
+
+	w.Reset()
+	rb.Redraw()
+	if w.String() != "\r\033[J> abc\b" {
+		t.Fatalf("redraw: %q", w.String())
+	}
+}
+
+func TestTheme(t *testing.T) {
+	for _, env := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("TERM", "xterm")
+
+	w := bytes.NewBuffer(nil)
+	cfg := &Config{ForceUseInteractive: true, DisableHideCursor: true, Theme: &Theme{Prompt: "32", Hint: "2"}}
+	rb := NewRuneBuffer(w, "> ", cfg, 80)
+	rb.WriteString("ab")
+	rb.SetHint("!")
+	w.Reset()
+	rb.Redraw()
+	if w.String() != "\r\033[J\033[32m> \033[0mab\033[2m!\033[0m\b" {
+		t.Fatalf("theme: %q", w.String())
+	}
+
+	// NO_COLOR turns the colors off
+	t.Setenv("NO_COLOR", "1")
+	w.Reset()
+	rb.Redraw()
+	if w.String() != "\r\033[J> ab!\b" {
+		t.Fatalf("no color: %q", w.String())
+	}
+
+	for _, c := range []struct {
+		mode   ColorMode
+		env    [][2]string
+		expect bool
+	}{
+		{ColorAuto, [][2]string{{"NO_COLOR", "1"}, {"CLICOLOR_FORCE", "1"}}, false},
+		{ColorAuto, [][2]string{{"TERM", "dumb"}, {"CLICOLOR_FORCE", "1"}}, true},
+		{ColorAuto, [][2]string{{"CLICOLOR", "0"}}, false},
+		{ColorAuto, [][2]string{{"CLICOLOR", "0"}, {"CLICOLOR_FORCE", "0"}}, false},
+		{ColorAlways, [][2]string{{"NO_COLOR", "1"}}, true},
+		{ColorNever, nil, false},
+	} {
+		for _, env := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE"} {
+			t.Setenv(env, "")
+		}
+		t.Setenv("TERM", "xterm")
+		for _, kv := range c.env {
+			t.Setenv(kv[0], kv[1])
+		}
+		cfg := &Config{Theme: &Theme{Prompt: "32"}, ColorMode: c.mode}
+		if on := cfg.ActiveTheme().Prompt != ""; on != c.expect {
+			t.Fatal("colors not expect", c.mode, c.env, on)
+		}
+	}
+}
+
+func TestMultiLinePrompt(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	cfg := &Config{ForceUseInteractive: true, DisableHideCursor: true}
+	rb := NewRuneBuffer(w, "\033[1mheader\033[0m\n> ", cfg, 4)
+	rb.WriteString("abc")
+
+	// "header" wraps over two rows, then "> abc" takes another two
+	if n := rb.IdxLine(4); n != 3 {
+		t.Fatalf("cursor row: %d", n)
+	}
+	if n := rb.LineCount(4); n != 4 {
+		t.Fatalf("line count: %d", n)
+	}
+	if n := rb.PromptLen(); n != 2 {
+		t.Fatalf("prompt width: %d", n)
+	}
+
+	w.Reset()
+	rb.Clean()
+	if w.String() != strings.Repeat("\033[2K\r\033[A", 3)+"\033[2K\r" {
+		t.Fatalf("clean: %q", w.String())
+	}
+
+	w.Reset()
+	rb.Redraw()
+	if !strings.HasPrefix(w.String(), "\033[2A\r\033[J\033[1mheader") {
+		t.Fatalf("redraw: %q", w.String())
+	}
+}
+
+func TestHorizontalScroll(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	cfg := &Config{ForceUseInteractive: true, DisableHideCursor: true, HorizontalScroll: true}
+	rb := NewRuneBuffer(w, "> ", cfg, 10)
+	rb.WriteString("abcdefghij")
+
+	if out := string(rb.output()); out != "> <efghij" {
+		t.Fatalf("end: %q", out)
+	}
+	if n := rb.LineCount(-1); n != 1 {
+		t.Fatalf("line count: %d", n)
+	}
+	rb.MoveToLineStart()
+	if out := string(rb.output()); out != "> abcdef>\b\b\b\b\b\b\b" {
+		t.Fatalf("start: %q", out)
+	}
+	rb.MoveToLineEnd()
+	rb.Kill()
+	for i := 0; i < 5; i++ {
+		rb.Backspace()
+	}
+	if out := string(rb.output()); out != "> abcde" {
+		t.Fatalf("shorter: %q", out)
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	cfg := &Config{ForceUseInteractive: true, TabWidth: 2}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 80)
+	rb.WriteString("a\tb")
+	rb.MoveBackward()
+	rb.MoveBackward()
+	if out := string(rb.output()); out != "> a  b\b\b\b" {
+		t.Fatalf("blanks: %q", out)
+	}
+
+	cfg.TabAsCaret = true
+	if out := string(rb.output()); out != "> a^Ib\b\b\b" {
+		t.Fatalf("caret: %q", out)
+	}
+	if n := rb.LineCount(5); n != 2 {
+		t.Fatalf("line count: %d", n)
+	}
+}
+
+func TestWrappedCursor(t *testing.T) {
+	cfg := &Config{ForceUseInteractive: true}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 10)
+	rb.WriteString("abcdefghijklmno")
+	for i := 0; i < 12; i++ {
+		rb.MoveBackward()
+	}
+
+	// backspaces wouldn't get from the second row back to the first
+	want := "> abcdefghijklmno\033[1A\r\033[5C"
+	if out := string(rb.output()); out != want {
+		t.Fatalf("output not expect: %q", out)
+	}
+	if n := rb.IdxLine(10); n != 0 {
+		t.Fatalf("cursor row: %d", n)
+	}
+}
+
+func TestWordWrap(t *testing.T) {
+	cfg := &Config{ForceUseInteractive: true, WordWrap: true}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 10)
+	rb.WriteString("hello big world")
+
+	if out := string(rb.output()); out != "> hello   big world" {
+		t.Fatalf("output not expect: %q", out)
+	}
+	if n := rb.IdxLine(10); n != 1 {
+		t.Fatalf("cursor row: %d", n)
+	}
+	if n := rb.LineCount(10); n != 2 {
+		t.Fatalf("line count: %d", n)
+	}
+
+	rb.MoveToLineStart()
+	rb.MoveForward()
+	rb.MoveForward()
+	if out := string(rb.output()); out != "> hello   big world\033[1A\r\033[4C" {
+		t.Fatalf("output not expect: %q", out)
+	}
+	if string(rb.Runes()) != "hello big world" {
+		t.Fatal("line changed")
+	}
+}
+
+func benchmarkRefresh(b *testing.B, cfg *Config, line string) {
+	cfg.ForceUseInteractive = true
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 80)
+	rb.Set([]rune(line))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Refresh(nil)
+	}
+}
+
+func BenchmarkRefreshShort(b *testing.B) {
+	benchmarkRefresh(b, &Config{}, "echo hello")
+}
+
+func BenchmarkRefreshWrapped(b *testing.B) {
+	benchmarkRefresh(b, &Config{}, strings.Repeat("wrapped ", 40))
+}
+
+func BenchmarkRefreshWide(b *testing.B) {
+	benchmarkRefresh(b, &Config{}, strings.Repeat("世界", 60))
+}
+
+func BenchmarkRefreshMask(b *testing.B) {
+	benchmarkRefresh(b, &Config{EnableMask: true}, strings.Repeat("secret", 10))
+}
+
+// editing in the middle of a long line, with and without drawing it
+func benchmarkEditLargeLine(b *testing.B, interactive bool) {
+	cfg := &Config{ForceUseInteractive: interactive, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 80)
+	rb.Set([]rune(strings.Repeat(`{"key": "value"}, `, 1000)))
+	rb.idx = rb.Len() / 2
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.WriteRune('x')
+		rb.Backspace()
+	}
+}
+
+func BenchmarkEditLargeLine(b *testing.B) {
+	benchmarkEditLargeLine(b, false)
+}
+
+func BenchmarkEditLargeLineRefresh(b *testing.B) {
+	benchmarkEditLargeLine(b, true)
+}
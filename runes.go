@@ -113,10 +113,12 @@ func (Runes) Index(r rune, rs []rune) int {
 	return -1
 }
 
+// ColorFilter drops the SGR sequences and OSC strings, e.g. hyperlinks, to
+// leave the runes which take up room on the screen.
 func (Runes) ColorFilter(r []rune) []rune {
 	newr := make([]rune, 0, len(r))
 	for pos := 0; pos < len(r); pos++ {
-		if r[pos] == '\033' && r[pos+1] == '[' {
+		if r[pos] == '\033' && pos+1 < len(r) && r[pos+1] == '[' {
 			idx := runes.Index('m', r[pos+2:])
 			if idx == -1 {
 				continue
@@ -124,11 +126,31 @@ func (Runes) ColorFilter(r []rune) []rune {
 			pos += idx + 2
 			continue
 		}
+		if r[pos] == '\033' && pos+1 < len(r) && r[pos+1] == ']' {
+			if end := oscEnd(r, pos+2); end >= 0 {
+				pos = end
+			}
+			continue
+		}
 		newr = append(newr, r[pos])
 	}
 	return newr
 }
 
+// oscEnd returns the index of the BEL or the "\\" of the ST ending the OSC
+// string starting at r[i], or -1.
+func oscEnd(r []rune, i int) int {
+	for ; i < len(r); i++ {
+		switch {
+		case r[i] == CharBell:
+			return i
+		case r[i] == '\033' && i+1 < len(r) && r[i+1] == '\\':
+			return i + 1
+		}
+	}
+	return -1
+}
+
 var zeroWidth = []*unicode.RangeTable{
 	unicode.Mn,
 	unicode.Me,
@@ -147,6 +169,13 @@ func (Runes) Width(r rune) int {
 	if r == '\t' {
 		return TabWidth
 	}
+	if r < utf8.RuneSelf {
+		// the tables are slow, and only have the control characters here
+		if r < ' ' || r == CharBackspace {
+			return 0
+		}
+		return 1
+	}
 	if unicode.IsOneOf(zeroWidth, r) {
 		return 0
 	}
@@ -16,6 +16,8 @@ func TestRuneWidth(t *testing.T) {
 		{[]rune("a"), 1},
 		{[]rune("你"), 2},
 		{runes.ColorFilter([]rune("☭\033[13;1m你")), 3},
+		{runes.ColorFilter([]rune(Hyperlink("https://example.com", "docs") + "\033]0;title\a!")), 5},
+		{runes.ColorFilter([]rune("a\033")), 1},
 	}
 	for _, r := range rs {
 		if w := runes.WidthAll(r.r); w != r.length {
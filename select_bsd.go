@@ -0,0 +1,15 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package rawterm
+
+import "syscall"
+
+// fd_set is made of 32 bit words on darwin, netbsd and openbsd, freebsd and
+// dragonfly use longs which is the same thing on little endian.
+type fdMask uint32
+
+const fdMaskBits = 32
+
+func sysSelect(n int, r *syscall.FdSet) error {
+	return syscall.Select(n, r, nil, nil, nil)
+}
@@ -0,0 +1,13 @@
+package rawterm
+
+import "syscall"
+
+// fd_set is made of longs on linux
+type fdMask uintptr
+
+const fdMaskBits = 32 << (^uintptr(0) >> 63)
+
+func sysSelect(n int, r *syscall.FdSet) error {
+	_, err := syscall.Select(n, r, nil, nil, nil)
+	return err
+}
@@ -0,0 +1,68 @@
+package rawterm
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// signalKeys are the keys Config.KernelSignals leaves to the terminal.
+var signalKeys = []rune{CharInterrupt, CharCtrlZ}
+
+// signalKey returns the key which sends sig, or 0.
+func signalKey(sig os.Signal) rune {
+	for _, r := range signalKeys {
+		if s := keySignal(r); s != nil && s == sig {
+			return r
+		}
+	}
+	return 0
+}
+
+// signalWatch catches the signals of Ctrl-C and Ctrl-Z while a line is read
+// with Config.KernelSignals, so the ioloop handles them like the keys.
+type signalWatch struct {
+	m  sync.Mutex
+	on bool
+	ch chan os.Signal
+}
+
+func (s *signalWatch) notify() {
+	for _, r := range signalKeys {
+		if sig := keySignal(r); sig != nil {
+			signal.Notify(s.ch, sig)
+		}
+	}
+}
+
+func (s *signalWatch) start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.on = true
+	s.notify()
+}
+
+func (s *signalWatch) stop() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.on = false
+	signal.Stop(s.ch)
+}
+
+// pause lets the signals take their default action until resume, so
+// SuspendMe can stop the process.
+func (s *signalWatch) pause() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.on {
+		signal.Stop(s.ch)
+	}
+}
+
+func (s *signalWatch) resume() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.on {
+		s.notify()
+	}
+}
@@ -1,12 +1,17 @@
 package rawterm
 
 import (
+	"errors"
 	"io"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// the streams a Config uses unless it has its own. On a Windows console
+// without ANSI support each Config reads and writes them through its own
+// RawReader and ANSIWriter.
 var (
 	Stdin  io.ReadCloser  = os.Stdin
 	Stdout io.WriteCloser = os.Stdout
@@ -38,44 +43,67 @@ func Line(prompt string) (string, error) {
 	return ins.Readline()
 }
 
+// ErrCanceled is returned by CancelableStdin.Read after Cancel.
+var ErrCanceled = errors.New("read canceled")
+
+// CancelableStdin wraps a reader whose Read may block forever, like os.Stdin,
+// so that a pending Read can be given up on. A single goroutine does the
+// actual reads, data it gets after a Read was canceled is kept for the next
+// Read, nothing is lost.
 type CancelableStdin struct {
 	r      io.Reader
 	mutex  sync.Mutex
 	stop   chan struct{}
 	closed int32
-	notify chan struct{}
-	data   []byte
-	read   int
-	err    error
+	cancel chan struct{}
+	// set while a Read is waiting for data
+	waiting int32
+	req     chan int
+	res     chan readResult
+
+	// a read was requested from the goroutine and not collected yet
+	pending bool
+	data    []byte
+	err     error
+}
+
+type readResult struct {
+	data []byte
+	err  error
 }
 
 func NewCancelableStdin(r io.Reader) *CancelableStdin {
 	c := &CancelableStdin{
 		r:      r,
-		notify: make(chan struct{}),
 		stop:   make(chan struct{}),
+		cancel: make(chan struct{}, 1),
+		req:    make(chan int),
+		res:    make(chan readResult),
 	}
 	go c.ioloop()
 	return c
 }
 
 func (c *CancelableStdin) ioloop() {
-loop:
 	for {
+		var size int
 		select {
-		case <-c.notify:
-			c.read, c.err = c.r.Read(c.data)
-			select {
-			case c.notify <- struct{}{}:
-			case <-c.stop:
-				break loop
-			}
+		case size = <-c.req:
 		case <-c.stop:
-			break loop
+			return
+		}
+		buf := make([]byte, size)
+		n, err := c.r.Read(buf)
+		select {
+		case c.res <- readResult{buf[:n], err}:
+		case <-c.stop:
+			return
 		}
 	}
 }
 
+// Read reads from the underlying reader. It returns ErrCanceled if Cancel is
+// called while it's waiting and io.EOF once the CancelableStdin is closed.
 func (c *CancelableStdin) Read(b []byte) (n int, err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -83,23 +111,85 @@ func (c *CancelableStdin) Read(b []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	c.data = b
+	// drop a Cancel which raced with the end of the previous Read
 	select {
-	case c.notify <- struct{}{}:
-	case <-c.stop:
-		return 0, io.EOF
+	case <-c.cancel:
+	default:
+	}
+
+	if len(c.data) == 0 && c.err == nil {
+		if !c.pending {
+			select {
+			case c.req <- len(b):
+				c.pending = true
+			case <-c.stop:
+				return 0, io.EOF
+			}
+		}
+		atomic.StoreInt32(&c.waiting, 1)
+		select {
+		case res := <-c.res:
+			c.pending = false
+			c.data, c.err = res.data, res.err
+		case <-c.cancel:
+			atomic.StoreInt32(&c.waiting, 0)
+			return 0, ErrCanceled
+		case <-c.stop:
+			return 0, io.EOF
+		}
+		atomic.StoreInt32(&c.waiting, 0)
+	}
+
+	n = copy(b, c.data)
+	c.data = c.data[n:]
+	if len(c.data) == 0 {
+		err, c.err = c.err, nil
+	}
+	return n, err
+}
+
+// Cancel makes a Read which is waiting for data return ErrCanceled. It has no
+// effect if there is none.
+func (c *CancelableStdin) Cancel() {
+	if atomic.LoadInt32(&c.waiting) == 0 {
+		return
 	}
 	select {
-	case <-c.notify:
-		return c.read, c.err
-	case <-c.stop:
-		return 0, io.EOF
+	case c.cancel <- struct{}{}:
+	default:
 	}
 }
 
+// Close makes all reads return io.EOF. The underlying reader is not closed,
+// if a read on it is in progress the goroutine doing it exits once it returns.
 func (c *CancelableStdin) Close() error {
 	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		close(c.stop)
 	}
 	return nil
 }
+
+// rateLimitWriter paces writes so that no more than rate bytes per second go
+// to the underlying writer.
+type rateLimitWriter struct {
+	w    io.Writer
+	rate int
+	next time.Time
+	sync.Mutex
+}
+
+func newRateLimitWriter(w io.Writer, rate int) *rateLimitWriter {
+	return &rateLimitWriter{w: w, rate: rate}
+}
+
+func (w *rateLimitWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if d := time.Until(w.next); d > 0 {
+		time.Sleep(d)
+	}
+	n, err := w.w.Write(b)
+	w.next = time.Now().Add(time.Duration(n) * time.Second / time.Duration(w.rate))
+	return n, err
+}
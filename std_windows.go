@@ -2,8 +2,67 @@
 
 package rawterm
 
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+var (
+	// vtInput is set when the console supports ENABLE_VIRTUAL_TERMINAL_INPUT,
+	// MakeRaw turns it on and Stdin delivers escape sequences like a unix tty.
+	vtInput bool
+	// vtOutput is set when the console interprets ANSI escape sequences by
+	// itself (Windows Terminal, conhost since Windows 10).
+	vtOutput bool
+)
+
 func init() {
-	Stdin = NewRawReader()
-	Stdout = NewANSIWriter(Stdout)
-	Stderr = NewANSIWriter(Stderr)
+	// mintty and friends are xterm compatible, talk to the pipes directly
+	if isCygwin = isCygwinTerminal(int(syscall.Stdin)); isCygwin {
+		return
+	}
+
+	vtOutput = enableConsoleMode(int(syscall.Stdout), enableVirtualTerminalProcessing, true)
+	if vtOutput {
+		enableConsoleMode(int(syscall.Stderr), enableVirtualTerminalProcessing, true)
+	}
+	vtInput = vtOutput && enableConsoleMode(int(syscall.Stdin), enableVirtualTerminalInput, false)
+}
+
+// consoleInput returns what the keys are read from for r, a new RawReader
+// for the console if it can't send escape sequences itself. Each Config
+// gets its own, see Config.Init.
+func consoleInput(r io.Reader) io.Reader {
+	if r == io.Reader(os.Stdin) && !isCygwin && !vtInput {
+		return NewRawReader()
+	}
+	return r
+}
+
+// ttyInput returns what the keys are read from for tty, the CONIN$ of
+// openTTY, which gets the same setup as the console behind Stdin.
+func ttyInput(tty *os.File) io.Reader {
+	if hasVTInput(int(tty.Fd())) {
+		return tty
+	}
+	return newRawReader(tty.Fd())
+}
+
+// hasVTInput reports whether the console input fd can send escape
+// sequences, see vtInput.
+func hasVTInput(fd int) bool {
+	if fd == int(syscall.Stdin) {
+		return vtInput
+	}
+	return vtOutput && enableConsoleMode(fd, enableVirtualTerminalInput, false)
+}
+
+// consoleOutput returns w, with an ANSIWriter in front if it's the console
+// and the console doesn't understand ANSI itself.
+func consoleOutput(w io.Writer) io.Writer {
+	if w == io.Writer(os.Stdout) || w == io.Writer(os.Stderr) {
+		return newConsoleWriter(w)
+	}
+	return w
 }
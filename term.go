@@ -34,10 +34,20 @@ func IsTerminal(fd int) bool {
 	return err == 0
 }
 
+// Termios is the terminal setup MakeRawWith passes to its callback before
+// applying it.
+type Termios = syscall.Termios
+
 // MakeRaw put the terminal connected to the given file descriptor into raw
 // mode and returns the previous state of the terminal so that it can be
 // restored.
 func MakeRaw(fd int) (*State, error) {
+	return MakeRawWith(fd, 0, nil)
+}
+
+// MakeRawWith is MakeRaw which leaves the parts selected by flags enabled and
+// lets fn change the new setup, e.g. VMIN and VTIME, before it's applied.
+func MakeRawWith(fd int, flags RawModeFlags, fn func(*Termios)) (*State, error) {
 	var oldState State
 	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlReadTermios, uintptr(unsafe.Pointer(&oldState.termios)), 0, 0, 0); err != 0 {
 		return nil, err
@@ -51,6 +61,15 @@ func MakeRaw(fd int) (*State, error) {
 	newState.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
 	newState.Cflag &^= syscall.CSIZE | syscall.PARENB
 	newState.Cflag |= syscall.CS8
+	if flags&RawKeepSignals != 0 {
+		newState.Lflag |= oldState.termios.Lflag & syscall.ISIG
+	}
+	if flags&RawKeepFlowControl != 0 {
+		newState.Iflag |= oldState.termios.Iflag & syscall.IXON
+	}
+	if fn != nil {
+		fn(&newState)
+	}
 
 	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlWriteTermios, uintptr(unsafe.Pointer(&newState)), 0, 0, 0); err != 0 {
 		return nil, err
@@ -70,14 +89,15 @@ func GetState(fd int) (*State, error) {
 	return &oldState, nil
 }
 
-// Restore restores the terminal connected to the given file descriptor to a
-// previous state.
 func restoreTerm(fd int, state *State) error {
-	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlWriteTermios, uintptr(unsafe.Pointer(&state.termios)), 0, 0, 0)
-	return err
+	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlWriteTermios, uintptr(unsafe.Pointer(&state.termios)), 0, 0, 0); err != 0 {
+		return err
+	}
+	return nil
 }
 
-// GetSize returns the dimensions of the given terminal.
+// GetSize returns the dimensions of the given terminal, -1, -1 if it isn't
+// one.
 func GetSize(fd int) (width, height int, err error) {
 	var dimensions [4]uint16
 
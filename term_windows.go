@@ -34,6 +34,9 @@ const (
 	enableAutoPosition    = 256
 	enableProcessedOutput = 1
 	enableWrapAtEolOutput = 2
+
+	enableVirtualTerminalInput      = 0x200
+	enableVirtualTerminalProcessing = 4
 )
 
 var kernel32 = syscall.NewLazyDLL("kernel32.dll")
@@ -66,58 +69,120 @@ type (
 
 type State struct {
 	mode uint32
+	// saved `stty -g` output when running on a cygwin pty
+	stty string
 }
 
 // IsTerminal returns true if the given file descriptor is a terminal.
 func IsTerminal(fd int) bool {
+	if isCygwinTerminal(fd) {
+		return true
+	}
 	var st uint32
 	r, _, e := syscall.Syscall(procGetConsoleMode.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&st)), 0)
 	return r != 0 && e == 0
 }
 
+// Termios is the terminal setup MakeRawWith passes to its callback before
+// applying it, on Windows the console mode.
+type Termios struct {
+	Mode uint32
+}
+
 // MakeRaw put the terminal connected to the given file descriptor into raw
 // mode and returns the previous state of the terminal so that it can be
 // restored.
 func MakeRaw(fd int) (*State, error) {
+	return MakeRawWith(fd, 0, nil)
+}
+
+// MakeRawWith is MakeRaw which leaves the parts selected by flags enabled and
+// lets fn change the new console mode before it's applied. The console has
+// no flow control, RawKeepFlowControl only applies to cygwin ptys, where fn
+// isn't called.
+func MakeRawWith(fd int, flags RawModeFlags, fn func(*Termios)) (*State, error) {
+	if isCygwinTerminal(fd) {
+		return sttyMakeRaw(flags)
+	}
 	var st uint32
 	_, _, e := syscall.Syscall(procGetConsoleMode.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&st)), 0)
 	if e != 0 {
 		return nil, error(e)
 	}
 	raw := st &^ (enableEchoInput | enableProcessedInput | enableLineInput | enableProcessedOutput)
+	if hasVTInput(fd) {
+		raw |= enableVirtualTerminalInput
+	}
+	if flags&RawKeepSignals != 0 {
+		raw |= st & enableProcessedInput
+	}
+	if fn != nil {
+		t := Termios{Mode: raw}
+		fn(&t)
+		raw = t.Mode
+	}
 	_, _, e = syscall.Syscall(procSetConsoleMode.Addr(), 2, uintptr(fd), uintptr(raw), 0)
 	if e != 0 {
 		return nil, error(e)
 	}
-	return &State{st}, nil
+	return &State{mode: st}, nil
 }
 
 // GetState returns the current state of a terminal which may be useful to
 // restore the terminal after a signal.
 func GetState(fd int) (*State, error) {
+	if isCygwinTerminal(fd) {
+		return sttyGetState()
+	}
 	var st uint32
 	_, _, e := syscall.Syscall(procGetConsoleMode.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&st)), 0)
 	if e != 0 {
 		return nil, error(e)
 	}
-	return &State{st}, nil
+	return &State{mode: st}, nil
 }
 
-// Restore restores the terminal connected to the given file descriptor to a
-// previous state.
 func restoreTerm(fd int, state *State) error {
-	_, _, err := syscall.Syscall(procSetConsoleMode.Addr(), 2, uintptr(fd), uintptr(state.mode), 0)
-	return err
+	if state.stty != "" {
+		return sttyRestore(state)
+	}
+	if _, _, e := syscall.Syscall(procSetConsoleMode.Addr(), 2, uintptr(fd), uintptr(state.mode), 0); e != 0 {
+		return error(e)
+	}
+	return nil
+}
+
+// enableConsoleMode tries to add flag to the console mode of fd and reports
+// whether the console accepted it. If keep is false the old mode is restored.
+func enableConsoleMode(fd int, flag uint32, keep bool) bool {
+	var st uint32
+	r, _, _ := syscall.Syscall(procGetConsoleMode.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&st)), 0)
+	if r == 0 {
+		return false
+	}
+	r, _, _ = syscall.Syscall(procSetConsoleMode.Addr(), 2, uintptr(fd), uintptr(st|flag), 0)
+	if r == 0 {
+		return false
+	}
+	if !keep {
+		syscall.Syscall(procSetConsoleMode.Addr(), 2, uintptr(fd), uintptr(st), 0)
+	}
+	return true
 }
 
-// GetSize returns the dimensions of the given terminal.
+// GetSize returns the dimensions of the visible part of the given console,
+// -1, -1 if it isn't one.
 func GetSize(fd int) (width, height int, err error) {
+	if isCygwinTerminal(fd) {
+		return sttyGetSize()
+	}
 	var info consoleScreenBufferInfo
 	_, _, e := syscall.Syscall(procGetConsoleScreenBufferInfo.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&info)), 0)
 	if e != 0 {
-		return 0, 0, error(e)
+		return -1, -1, error(e)
 	}
-	return int(info.size.x), int(info.size.y), nil
+	w := info.window
+	return int(w.right-w.left) + 1, int(w.bottom-w.top) + 1, nil
 }
 
 // ReadPassword reads a line of input from a terminal without local echo.  This
@@ -2,17 +2,20 @@ package rawterm
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Terminal struct {
 	m         sync.Mutex
 	cfg       *Config
-	outchan   chan rune
+	outchan   chan KeyEvent
 	closed    int32
 	stopChan  chan struct{}
 	kickChan  chan struct{}
@@ -20,21 +23,60 @@ type Terminal struct {
 	isReading int32
 	sleeping  int32
 
+	cursorHidden int32
+
+	// what the keys are read from, Config.Stdin or the cancelable reader
+	// made for it, which Close closes
+	stdin io.Reader
+
+	// raw mode is only entered on the first EnterRawMode and left on the
+	// last matching ExitRawMode.
+	rawLock  sync.Mutex
+	rawCount int
+	// set while more input is already buffered behind the rune being
+	// delivered, e.g. in the middle of a paste.
+	pending int32
+
 	sizeChan chan string
+	// answers to OSC 11, see Background
+	bgChan chan string
+	bgOnce sync.Once
+	bg     Color
+	bgOK   bool
+
+	// bytes written by Write, see Stats
+	written int64
+
+	// gets a copy of everything written to the terminal, see SetRecorder
+	recLock  sync.Mutex
+	recorder io.Writer
+
+	// set by SetScrollRegion, protected by m
+	regionTop, regionBottom int
+	onScrollRegion          func(top, bottom int)
+	// set by the Operation to redraw the line around WriteInline
+	onInline func(write func())
 }
 
 func NewTerminal(cfg *Config) (*Terminal, error) {
 	if err := cfg.Init(); err != nil {
 		return nil, err
 	}
+	stdin := cfg.Stdin
+	if cfg.wrapStdin {
+		stdin = newStdinReader(stdin)
+	}
 	t := &Terminal{
 		cfg:      cfg,
+		stdin:    stdin,
 		kickChan: make(chan struct{}, 1),
-		outchan:  make(chan rune),
+		outchan:  make(chan KeyEvent),
 		stopChan: make(chan struct{}, 1),
 		sizeChan: make(chan string, 1),
+		bgChan:   make(chan string, 1),
 	}
 
+	t.wg.Add(1)
 	go t.ioloop()
 	return t, nil
 }
@@ -46,23 +88,143 @@ func (t *Terminal) SleepToResume() {
 	}
 	defer atomic.StoreInt32(&t.sleeping, 0)
 
-	t.ExitRawMode()
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+
+	if t.rawCount > 0 {
+		t.exitRaw()
+	}
 	ch := WaitForResume()
 	SuspendMe()
 	<-ch
-	t.EnterRawMode()
+	if t.rawCount > 0 {
+		t.makeRaw()
+	}
 }
 
+// EnterRawMode switches the terminal to raw mode. Calls can be nested, only
+// the first one changes the terminal and each needs a matching ExitRawMode.
 func (t *Terminal) EnterRawMode() (err error) {
-	return t.cfg.FuncMakeRaw()
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+
+	t.rawCount++
+	if t.rawCount > 1 {
+		return nil
+	}
+	return t.makeRaw()
 }
 
+// ExitRawMode undoes one EnterRawMode, the terminal is restored when the
+// outermost one exits.
 func (t *Terminal) ExitRawMode() (err error) {
-	return t.cfg.FuncExitRaw()
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+
+	if t.rawCount == 0 {
+		return nil
+	}
+	t.rawCount--
+	if t.rawCount > 0 {
+		return nil
+	}
+	return t.exitRaw()
+}
+
+// ForceRestore leaves raw mode regardless of how many EnterRawMode calls
+// are pending, restoring the terminal to the state it had before.
+func (t *Terminal) ForceRestore() error {
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+
+	if t.rawCount == 0 {
+		return t.config().FuncExitRaw()
+	}
+	t.rawCount = 0
+	return t.exitRaw()
+}
+
+const (
+	// push the kitty keyboard flags "disambiguate escape codes" and turn on
+	// xterm's modifyOtherKeys, terminals without them ignore both.
+	keyboardEnhance = "\033[>1u\033[>4;2m"
+	keyboardRestore = "\033[<u\033[>4m"
+)
+
+// pauseRaw leaves raw mode until resumeRaw without changing how many
+// EnterRawMode calls are pending.
+func (t *Terminal) pauseRaw() {
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+	if t.rawCount > 0 {
+		t.exitRaw()
+	}
+}
+
+func (t *Terminal) resumeRaw() {
+	t.rawLock.Lock()
+	defer t.rawLock.Unlock()
+	if t.rawCount > 0 {
+		t.makeRaw()
+	}
+}
+
+// makeRaw and exitRaw switch the terminal mode, called with rawLock held.
+func (t *Terminal) makeRaw() error {
+	cfg := t.config()
+	err := cfg.FuncMakeRaw()
+	if cfg.EnhancedKeyboard {
+		t.Write([]byte(keyboardEnhance))
+	}
+	return err
+}
+
+func (t *Terminal) exitRaw() error {
+	cfg := t.config()
+	if cfg.EnhancedKeyboard {
+		t.Write([]byte(keyboardRestore))
+	}
+	return cfg.FuncExitRaw()
 }
 
 func (t *Terminal) Write(b []byte) (int, error) {
-	return t.cfg.Stdout.Write(b)
+	n, err := t.config().Stdout.Write(b)
+	atomic.AddInt64(&t.written, int64(n))
+	t.recordOutput(b[:n])
+	return n, err
+}
+
+// SetRecorder makes the terminal copy all output, including what's written
+// through Operation.Stdout and Stderr, to w. nil stops the recording.
+func (t *Terminal) SetRecorder(w io.Writer) {
+	t.recLock.Lock()
+	t.recorder = w
+	t.recLock.Unlock()
+}
+
+func (t *Terminal) recordOutput(b []byte) {
+	t.recLock.Lock()
+	defer t.recLock.Unlock()
+	if t.recorder != nil && len(b) > 0 {
+		t.recorder.Write(b)
+	}
+}
+
+const (
+	cursorHide = "\033[?25l"
+	cursorShow = "\033[?25h"
+)
+
+// HideCursor makes the cursor invisible until ShowCursor is called, Close
+// shows it again.
+func (t *Terminal) HideCursor() {
+	atomic.StoreInt32(&t.cursorHidden, 1)
+	t.Write([]byte(cursorHide))
+}
+
+func (t *Terminal) ShowCursor() {
+	atomic.StoreInt32(&t.cursorHidden, 0)
+	t.Write([]byte(cursorShow))
 }
 
 type termSize struct {
@@ -77,31 +239,223 @@ func (t *Terminal) GetOffset(f func(offset string)) {
 	t.Write([]byte("\033[6n"))
 }
 
+// how long GetCursorPos waits for the terminal to answer
+var cursorPosTimeout = time.Second
+
+// GetCursorPos asks the terminal where the cursor is, row and column count
+// from 1. The answer is taken out of the input, it never shows up as keys.
+func (t *Terminal) GetCursorPos() (row, col int, err error) {
+	if err := t.EnterRawMode(); err != nil {
+		return 0, 0, err
+	}
+	defer t.ExitRawMode()
+
+	// a late answer to an earlier query
+	select {
+	case <-t.sizeChan:
+	default:
+	}
+	t.Write([]byte("\033[6n"))
+	if !t.IsReading() {
+		t.KickRead()
+	}
+	select {
+	case attr := <-t.sizeChan:
+		row, col, _ = (&escapeKeyPair{attr: attr}).Get2()
+		return row, col, nil
+	case <-time.After(cursorPosTimeout):
+		return 0, 0, errors.New("terminal didn't report the cursor position")
+	}
+}
+
+// WriteInline writes raw, e.g. a sixel or iTerm2 image, above the prompt
+// and line, which are drawn again below it. A new line is started after
+// raw so the prompt doesn't share a row with it.
+func (t *Terminal) WriteInline(raw []byte) error {
+	t.m.Lock()
+	f := t.onInline
+	t.m.Unlock()
+
+	var err error
+	write := func() {
+		if _, err = t.Write(raw); err == nil {
+			_, err = t.Write([]byte("\r\n"))
+		}
+	}
+	if f != nil {
+		f(write)
+	} else {
+		write()
+	}
+	return err
+}
+
+// how long Background waits for the terminal to answer
+var backgroundTimeout = time.Second
+
+// Background asks the terminal for its background color with OSC 11, ok
+// is false if it doesn't answer. It's only asked once, the answer is kept.
+func (t *Terminal) Background() (c Color, ok bool) {
+	t.bgOnce.Do(func() {
+		if err := t.EnterRawMode(); err != nil {
+			return
+		}
+		defer t.ExitRawMode()
+
+		t.Write([]byte("\033]11;?\033\\"))
+		if !t.IsReading() {
+			t.KickRead()
+		}
+		select {
+		case reply := <-t.bgChan:
+			t.bg, t.bgOK = parseColorReply(reply)
+		case <-time.After(backgroundTimeout):
+		}
+	})
+	return t.bg, t.bgOK
+}
+
+// oscReply gets the OSC strings taken out of the input.
+func (t *Terminal) oscReply(data []rune) {
+	if s := string(data); strings.HasPrefix(s, "11;") {
+		select {
+		case t.bgChan <- s[3:]:
+		default:
+		}
+	}
+}
+
+// GetSize returns the size of the terminal. If the width or height func of
+// the config doesn't know it, it's found by moving the cursor to the bottom
+// right corner and asking where it ended up.
+func (t *Terminal) GetSize() (width, height int, err error) {
+	cfg := t.config()
+	width, height = cfg.FuncGetWidth(), cfg.FuncGetHeight()
+	if width > 0 && height > 0 {
+		return width, height, nil
+	}
+	t.Write([]byte("\0337\033[999;999H"))
+	defer t.Write([]byte("\0338"))
+	height, width, err = t.GetCursorPos()
+	return width, height, err
+}
+
 func (t *Terminal) Print(s string) {
-	fmt.Fprintf(t.cfg.Stdout, "%s", s)
+	io.WriteString(t, s)
 }
 
 func (t *Terminal) PrintRune(r rune) {
-	fmt.Fprintf(t.cfg.Stdout, "%c", r)
+	fmt.Fprintf(t, "%c", r)
 }
 
 func (t *Terminal) Readline() *Operation {
-	return NewOperation(t, t.cfg)
+	return NewOperation(t, t.config())
 }
 
 // return rune(0) if meet EOF
+// Alt chords without a Meta- constant are returned as the plain key.
 func (t *Terminal) ReadRune() rune {
-	ch, ok := <-t.outchan
+	r, _ := t.ReadKey().legacyRune()
+	return r
+}
+
+// ReadKey returns the next key event, KeyEvent{} if meet EOF.
+func (t *Terminal) ReadKey() KeyEvent {
+	ev, ok := <-t.outchan
 	if !ok {
-		return rune(0)
+		return KeyEvent{}
 	}
-	return ch
+	return ev
+}
+
+// ReadRunes reads n runes in raw mode without echoing them, for programs
+// which only need a keypress or two and no line editing. Keys come as
+// ReadRune returns them, e.g. Up as CharPrev, except that the ones without
+// a rune, like F1 or Alt chords, are skipped. Ctrl-C returns ErrInterrupt,
+// the runes read so far are returned with io.EOF if the input ends.
+//
+// It's meant for a Terminal made by NewTerminal, the Operation of an
+// Instance reads the same keys.
+func (t *Terminal) ReadRunes(n int) ([]rune, error) {
+	if err := t.EnterRawMode(); err != nil {
+		return nil, err
+	}
+	defer t.ExitRawMode()
+
+	rs := make([]rune, 0, n)
+	for len(rs) < n {
+		r, err := t.readRawRune()
+		if err != nil {
+			return rs, err
+		}
+		if r >= 0 {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+// ReadPassword reads a line in raw mode without echoing it, only Backspace
+// works for editing. Runes past maxLen are refused with a bell, 0 means no
+// limit. Ctrl-C returns ErrInterrupt and Ctrl-D on an empty line io.EOF.
+func (t *Terminal) ReadPassword(maxLen int) ([]byte, error) {
+	if err := t.EnterRawMode(); err != nil {
+		return nil, err
+	}
+	defer t.ExitRawMode()
+
+	var rs []rune
+	for {
+		r, err := t.readRawRune()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case r == CharEnter || r == CharCtrlJ:
+			return []byte(string(rs)), nil
+		case r == CharBackspace || r == CharCtrlH:
+			if len(rs) > 0 {
+				rs = rs[:len(rs)-1]
+			}
+		case r == CharDelete && len(rs) == 0:
+			return nil, io.EOF
+		case r < ' ':
+			// no other editing keys
+		case maxLen > 0 && len(rs) >= maxLen:
+			t.Bell()
+		default:
+			rs = append(rs, r)
+		}
+	}
+}
+
+// readRawRune waits for the next key for ReadRunes and ReadPassword, named
+// keys and Alt chords are -1.
+func (t *Terminal) readRawRune() (rune, error) {
+	t.KickRead()
+	ev, ok := <-t.outchan
+	if !ok {
+		return 0, io.EOF
+	}
+	if ev == (KeyEvent{Rune: CharInterrupt}) {
+		return 0, ErrInterrupt
+	}
+	if ev.Mod != 0 || ev.Rune < 0 {
+		return -1, nil
+	}
+	return ev.Rune, nil
 }
 
 func (t *Terminal) IsReading() bool {
 	return atomic.LoadInt32(&t.isReading) == 1
 }
 
+// hasPendingInput reports whether the last rune returned by ReadRune was
+// followed by more input which had already arrived.
+func (t *Terminal) hasPendingInput() bool {
+	return atomic.LoadInt32(&t.pending) == 1
+}
+
 func (t *Terminal) KickRead() {
 	select {
 	case t.kickChan <- struct{}{}:
@@ -109,8 +463,17 @@ func (t *Terminal) KickRead() {
 	}
 }
 
+// CancelRead aborts a pending read of Stdin if it supports it, as
+// CancelableStdin does. The terminal then waits for the next KickRead.
+func (t *Terminal) CancelRead() {
+	if c, ok := t.getStdin().(interface {
+		Cancel()
+	}); ok {
+		c.Cancel()
+	}
+}
+
 func (t *Terminal) ioloop() {
-	t.wg.Add(1)
 	defer func() {
 		t.wg.Done()
 		close(t.outchan)
@@ -120,9 +483,14 @@ func (t *Terminal) ioloop() {
 		isEscape       bool
 		isEscapeEx     bool
 		expectNextChar bool
+		escTimer       *time.Timer
+		escTimedOut    int32
+		// between the start and end of a bracketed paste
+		inPaste bool
 	)
 
 	buf := bufio.NewReader(t.getStdin())
+	var dec inputDecoder
 	for {
 		if !expectNextChar {
 			atomic.StoreInt32(&t.isReading, 0)
@@ -134,8 +502,37 @@ func (t *Terminal) ioloop() {
 			}
 		}
 		expectNextChar = false
-		r, _, err := buf.ReadRune()
+		cfg := t.config()
+		if !cfg.StrictInputOrder && !isEscape && !isEscapeEx && len(dec.partial) == 0 {
+			if skipped := skipToInterrupt(buf); skipped != nil {
+				// a paste may start or end in the dropped input
+				wasPaste := inPaste
+				inPaste = pasteOpen(skipped, inPaste)
+				if wasPaste && !inPaste && !t.send(KeyEvent{Mod: modPaste}, buf) {
+					return
+				}
+			}
+		}
+		r, err := dec.readRune(buf, cfg.InputEncoding, cfg.InvalidUTF8)
+		if escTimer != nil {
+			escTimer.Stop()
+			escTimer = nil
+		}
 		if err != nil {
+			if err == ErrCanceled {
+				if isEscape && atomic.SwapInt32(&escTimedOut, 0) == 1 {
+					// nothing followed the ESC in time, it's a key on its own
+					isEscape = false
+					expectNextChar = true
+					if !t.send(KeyEvent{Rune: CharEsc}, buf) {
+						return
+					}
+					continue
+				}
+				// wait for the next KickRead
+				isEscape, isEscapeEx = false, false
+				continue
+			}
 			if strings.Contains(err.Error(), "interrupted system call") {
 				expectNextChar = true
 				continue
@@ -143,6 +540,15 @@ func (t *Terminal) ioloop() {
 			break
 		}
 
+		ev := KeyEvent{Rune: r}
+		if inPaste && !isEscape && !isEscapeEx && r != CharEsc {
+			// pasted text, even Enter doesn't stop reading
+			expectNextChar = true
+			if !t.send(KeyEvent{Rune: r, Mod: modPaste}, buf) {
+				return
+			}
+			continue
+		}
 		if isEscape {
 			isEscape = false
 			if r == CharEscapeEx {
@@ -150,11 +556,38 @@ func (t *Terminal) ioloop() {
 				isEscapeEx = true
 				continue
 			}
-			r = escapeKey(r, buf)
+			ev = escapeKey(r, buf, t.oscReply)
+			if ev == (KeyEvent{}) {
+				expectNextChar = true
+				continue
+			}
 		} else if isEscapeEx {
 			isEscapeEx = false
 			if key := readEscKey(r, buf); key != nil {
+				if key.typ == '~' && (key.attr == "200" || key.attr == "201") {
+					// a bracketed paste starts or ends, the end is
+					// sent on so the pasted text gets inserted
+					expectNextChar = true
+					if inPaste = key.attr == "200"; !inPaste {
+						if !t.send(KeyEvent{Mod: modPaste}, buf) {
+							return
+						}
+					}
+					continue
+				}
 				r = escapeExKey(key)
+				ev = KeyEvent{Rune: r, Mod: keyModifier(key)}
+				if ext, ok := extendedKey(key); ok {
+					r, ev = ext.Rune, ext
+					if ev == (KeyEvent{Rune: CharEsc}) {
+						// the ESC key itself, not the start of a sequence
+						expectNextChar = true
+						if !t.send(ev, buf) {
+							return
+						}
+						continue
+					}
+				}
 				// offset
 				if key.typ == 'R' {
 					if _, _, ok := key.Get2(); ok {
@@ -174,20 +607,84 @@ func (t *Terminal) ioloop() {
 		}
 
 		expectNextChar = true
-		switch r {
-		case CharEsc:
+		switch ev {
+		case KeyEvent{Rune: CharEsc}:
 			isEscape = true
-		case CharInterrupt, CharEnter, CharCtrlJ, CharDelete:
+			if d := t.config().EscSequenceTimeout; d > 0 && buf.Buffered() == 0 {
+				atomic.StoreInt32(&escTimedOut, 0)
+				escTimer = time.AfterFunc(d, func() {
+					atomic.StoreInt32(&escTimedOut, 1)
+					t.CancelRead()
+				})
+			}
+		case KeyEvent{Rune: CharInterrupt}, KeyEvent{Rune: CharEnter},
+			KeyEvent{Rune: CharCtrlJ}, KeyEvent{Rune: CharDelete}:
 			expectNextChar = false
 			fallthrough
 		default:
-			t.outchan <- r
+			if !t.send(ev, buf) {
+				return
+			}
 		}
 	}
 
 }
 
+// skipToInterrupt drops the input buffered before a Ctrl-C if there's
+// more than interruptBacklog bytes of it, so it isn't held up by a large
+// paste. Keys typed ahead of it are still handled. It returns the dropped
+// input, which is only valid until buf is read again.
+func skipToInterrupt(buf *bufio.Reader) []byte {
+	n := buf.Buffered()
+	if n <= interruptBacklog {
+		return nil
+	}
+	b, _ := buf.Peek(n)
+	if i := bytes.IndexByte(b, CharInterrupt); i > interruptBacklog {
+		buf.Discard(i)
+		return b[:i]
+	}
+	return nil
+}
+
+const interruptBacklog = 256
+
+var (
+	pasteStart = []byte("\033[200~")
+	pasteEnd   = []byte("\033[201~")
+)
+
+// pasteOpen reports whether a bracketed paste is still going on after b,
+// inPaste is whether one was going on before it.
+func pasteOpen(b []byte, inPaste bool) bool {
+	start, end := bytes.LastIndex(b, pasteStart), bytes.LastIndex(b, pasteEnd)
+	if start < 0 && end < 0 {
+		return inPaste
+	}
+	return start > end
+}
+
+// send hands ev to the reader, it returns false if the terminal was closed.
+func (t *Terminal) send(ev KeyEvent, buf *bufio.Reader) bool {
+	if buf.Buffered() > 0 {
+		atomic.StoreInt32(&t.pending, 1)
+	} else {
+		atomic.StoreInt32(&t.pending, 0)
+	}
+	select {
+	case t.outchan <- ev:
+		return true
+	case <-t.stopChan:
+		return false
+	}
+}
+
+// Bell signals an invalid action, with Config.FuncBell if it's set.
 func (t *Terminal) Bell() {
+	if f := t.config().FuncBell; f != nil {
+		f()
+		return
+	}
 	fmt.Fprintf(t, "%c", CharBell)
 }
 
@@ -195,12 +692,15 @@ func (t *Terminal) Close() error {
 	if atomic.SwapInt32(&t.closed, 1) != 0 {
 		return nil
 	}
-	if closer, ok := t.cfg.Stdin.(io.Closer); ok {
+	if closer, ok := t.getStdin().(io.Closer); ok {
 		closer.Close()
 	}
 	close(t.stopChan)
 	t.wg.Wait()
-	return t.ExitRawMode()
+	if atomic.LoadInt32(&t.cursorHidden) == 1 {
+		t.ShowCursor()
+	}
+	return t.ForceRestore()
 }
 
 func (t *Terminal) GetConfig() *Config {
@@ -210,11 +710,15 @@ func (t *Terminal) GetConfig() *Config {
 	return &cfg
 }
 
-func (t *Terminal) getStdin() io.Reader {
+func (t *Terminal) config() *Config {
 	t.m.Lock()
-	r := t.cfg.Stdin
+	cfg := t.cfg
 	t.m.Unlock()
-	return r
+	return cfg
+}
+
+func (t *Terminal) getStdin() io.Reader {
+	return t.stdin
 }
 
 func (t *Terminal) SetConfig(c *Config) error {
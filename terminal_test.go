@@ -0,0 +1,346 @@
+package rawterm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawModeNesting(t *testing.T) {
+	var enter, exit int
+	term, err := NewTerminal(&Config{
+		Stdin:       NewCancelableStdin(bytes.NewBuffer(nil)),
+		Stdout:      ioutil.Discard,
+		FuncMakeRaw: func() error { enter++; return nil },
+		FuncExitRaw: func() error { exit++; return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer term.Close()
+
+	term.EnterRawMode()
+	term.EnterRawMode()
+	term.ExitRawMode()
+	if enter != 1 || exit != 0 {
+		t.Fatal("result not expect", enter, exit)
+	}
+	term.ExitRawMode()
+	term.ExitRawMode()
+	if enter != 1 || exit != 1 {
+		t.Fatal("result not expect", enter, exit)
+	}
+
+	term.EnterRawMode()
+	term.EnterRawMode()
+	term.ForceRestore()
+	if exit != 2 {
+		t.Fatal("result not expect", exit)
+	}
+}
+
+func TestIgnoredSequences(t *testing.T) {
+	// a mouse report and a color query reply aren't typed
+	in := "\033[<0;3;4Ma\033]11;rgb:0/0/0\033\\b\r"
+	rl, _ := newTestInstance(t, strings.NewReader(in))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+// chunkReader returns one chunk per Read, with ErrCanceled in between.
+type chunkReader struct {
+	chunks []string
+	cancel bool
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	if c.cancel = !c.cancel; !c.cancel {
+		return 0, ErrCanceled
+	}
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.chunks[0])
+	c.chunks = c.chunks[1:]
+	return n, nil
+}
+
+func TestUTF8Decoder(t *testing.T) {
+	for _, c := range []struct {
+		policy InvalidUTF8Policy
+		want   []rune
+	}{
+		{InvalidUTF8Replace, []rune("aé�b€�")},
+		{InvalidUTF8Skip, []rune("aéb€")},
+		{InvalidUTF8Raw, []rune{'a', 'é', 0xdcff, 'b', '€', 0xdce2}},
+	} {
+		// é and € split across reads, an invalid byte and a truncated €
+		buf := bufio.NewReader(&chunkReader{chunks: []string{"a\xc3", "\xa9\xffb\xe2\x82", "\xac\xe2"}})
+		var dec inputDecoder
+		var got []rune
+		for {
+			r, err := dec.readRune(buf, nil, c.policy)
+			if err == ErrCanceled {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			got = append(got, r)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("policy %d: got %U, want %U", c.policy, got, c.want)
+		}
+	}
+}
+
+func TestHideCursor(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("ab\r"), func(c *Config) {
+		c.Prompt = "> "
+		c.FuncIsTerminal = func() bool { return true }
+	})
+
+	rl.Terminal.HideCursor()
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	s := out.String()
+	if strings.Contains(s[strings.LastIndex(s, cursorHide):], cursorShow) {
+		t.Fatalf("cursor shown while hidden: %q", s)
+	}
+}
+
+func TestWriteInline(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	typed := make(chan struct{}, 1)
+	rl, out := newTestInstance(t, r, func(c *Config) {
+		c.Prompt = "> "
+		c.DisableHideCursor = true
+		c.FuncIsTerminal = func() bool { return true }
+		c.Listener = FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			if key == 'b' {
+				typed <- struct{}{}
+			}
+			return nil, 0, false
+		})
+	})
+
+	image := "\033Pq#0~~\033\\"
+	go func() {
+		w.Write([]byte("ab"))
+		<-typed
+		rl.Terminal.WriteInline([]byte(image))
+		w.Write([]byte("\r"))
+	}()
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	if s := out.String(); !strings.Contains(s, "\033[2K\r"+image+"\r\n> ab") {
+		t.Fatalf("line not redrawn below the image %q", s)
+	}
+}
+
+func TestInputEncoding(t *testing.T) {
+	rl, out := newTestInstance(t, strings.NewReader("caf\xe9\r"), func(c *Config) {
+		c.InputEncoding = Latin1
+		c.Prompt = "\u00bb "
+	})
+	if line, err := rl.Readline(); err != nil || line != "café" {
+		t.Fatal("result not expect", line, err)
+	}
+	if s := out.String(); !strings.Contains(s, "\xbb caf\xe9") || strings.Contains(s, "é") {
+		t.Fatalf("output not encoded: %q", out.String())
+	}
+	if b := CP437.Encode(nil, '░'); string(b) != "\xb0" {
+		t.Fatalf("CP437 not expect: %q", b)
+	}
+}
+
+func TestInterruptPriority(t *testing.T) {
+	in := strings.Repeat("a", 1000) + "\x03"
+	for _, strict := range []bool{false, true} {
+		rl, _ := newTestInstance(t, strings.NewReader(in), func(c *Config) {
+			c.StrictInputOrder = strict
+		})
+		if _, err := rl.Readline(); err != ErrInterrupt {
+			t.Fatal("result not expect", err)
+		}
+		if keys := rl.Stats().Keys; strict != (keys == 1001) {
+			t.Fatal("keys not expect", strict, keys)
+		}
+		rl.Close()
+	}
+}
+
+func TestInterruptPriorityPaste(t *testing.T) {
+	// the end of the paste is dropped with the backlog
+	in := "\033[200~" + strings.Repeat("a", 1000) + "\033[201~x \x03y\r"
+	rl, _ := newTestInstance(t, strings.NewReader(in), func(c *Config) {
+		c.BracketedPaste = true
+	})
+	if line, err := rl.Readline(); err != ErrInterrupt {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+	if line, err := rl.Readline(); err != nil || line != "y" {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	in := "a\033[200~b\tc\r\nd\x01\r\n\033[201~e\r"
+	rl, out := newTestInstance(t, strings.NewReader(in), func(c *Config) {
+		c.BracketedPaste = true
+	})
+	if line, err := rl.Readline(); err != nil || line != "ab\tc de" {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+	if !strings.HasPrefix(out.String(), "\033[?2004h") || !strings.HasSuffix(out.String(), "\033[?2004l") {
+		t.Fatalf("paste mode not toggled: %q", out.String())
+	}
+}
+
+func TestEscSequenceTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	clear := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		return nil, 0, true
+	}
+	rl, _ := newTestInstance(t, r,
+		WithEscSequenceTimeout(10*time.Millisecond),
+		WithKeyBinding(KeyEvent{Rune: CharEsc}, clear))
+
+	go func() {
+		w.Write([]byte("abc\x1b"))
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("xy\x1bbz\r"))
+	}()
+	line, err := rl.Readline()
+	if err != nil || line != "zxy" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+// answerWriter answers cursor position queries like a terminal would, or
+// the query if it's set.
+type answerWriter struct {
+	syncBuffer
+	answer func() string
+	w      io.Writer
+	query  string
+}
+
+func (a *answerWriter) Write(p []byte) (int, error) {
+	query := a.query
+	if query == "" {
+		query = "\033[6n"
+	}
+	if bytes.Contains(p, []byte(query)) {
+		go io.WriteString(a.w, a.answer())
+	}
+	return a.syncBuffer.Write(p)
+}
+
+func TestGetCursorPos(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	answer := "\033[5;10R"
+	out := &answerWriter{answer: func() string { return answer }, w: w}
+	width := 80
+	rl, err := NewWithStreams(r, out, WithWidthFunc(func() int { return width }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	row, col, err := rl.Terminal.GetCursorPos()
+	if err != nil || row != 5 || col != 10 {
+		t.Fatal("position not expect", row, col, err)
+	}
+
+	width, answer = -1, "\033[30;100R"
+	if w, h, err := rl.Terminal.GetSize(); err != nil || w != 100 || h != 30 {
+		t.Fatal("size not expect", w, h, err)
+	}
+
+	// an unasked for answer doesn't end up in the line either
+	go io.WriteString(w, "\033[1;1Rok\r")
+	if line, err := rl.Readline(); err != nil || line != "ok" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestBackground(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	out := &answerWriter{
+		answer: func() string { return "\033]11;rgb:ffff/ffff/dddd\033\\" },
+		w:      w,
+		query:  "\033]11;?",
+	}
+	rl, err := NewWithStreams(r, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	bg, ok := rl.Terminal.Background()
+	if !ok || bg != (Color{255, 255, 221}) || bg.Dark() {
+		t.Fatal("background not expect", bg, ok)
+	}
+	// the answer isn't read as keys
+	go io.WriteString(w, "ok\r")
+	if line, err := rl.Readline(); err != nil || line != "ok" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	for s, want := range map[string]Color{
+		"rgb:0/8/f":          {0, 136, 255},
+		"rgba:00/80/ff/ff":   {0, 128, 255},
+		"rgb:1e1e/1e1e/1e1e": {30, 30, 30},
+	} {
+		if c, ok := parseColorReply(s); !ok || c != want {
+			t.Fatal("color not expect", s, c, ok)
+		}
+	}
+	if _, ok := parseColorReply("rgb:zz/00/00"); ok {
+		t.Fatal("bad color parsed")
+	}
+}
+
+func TestTerminalReadRaw(t *testing.T) {
+	out := new(syncBuffer)
+	term, err := NewTerminal(&Config{
+		Stdin:          NewCancelableStdin(strings.NewReader("y\033OPnpass\x7fs\rsecret\r\x03")),
+		Stdout:         out,
+		FuncIsTerminal: func() bool { return true },
+		FuncMakeRaw:    func() error { return nil },
+		FuncExitRaw:    func() error { return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer term.Close()
+
+	if rs, err := term.ReadRunes(2); err != nil || string(rs) != "yn" {
+		t.Fatal("runes not expect", string(rs), err)
+	}
+	if pw, err := term.ReadPassword(0); err != nil || string(pw) != "pass" {
+		t.Fatal("password not expect", string(pw), err)
+	}
+	if pw, err := term.ReadPassword(4); err != nil || string(pw) != "secr" {
+		t.Fatal("password not expect", string(pw), err)
+	}
+	if _, err := term.ReadRunes(1); err != ErrInterrupt {
+		t.Fatal("error not expect", err)
+	}
+	if out.String() != "\a\a" {
+		t.Fatalf("output not expect %q", out.String())
+	}
+}
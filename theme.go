@@ -0,0 +1,110 @@
+package rawterm
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Theme colors the parts of the line and of the widgets built on it. Each
+// field is SGR parameters, e.g. "1;32" for bold green, an empty one leaves
+// that part as it is.
+type Theme struct {
+	// the prompt, around any colors it has itself
+	Prompt string
+	// hints shown after the line, see SetHint
+	Hint string
+	// suggested input, e.g. "did you mean" corrections
+	Suggestion string
+	// highlighted runes, e.g. the matching bracket instead of bold
+	Selection string
+	// hints about refused input, and errors shown by widgets
+	Error string
+}
+
+// Paint returns s in the colors of style, one of the Theme's fields.
+func (t Theme) Paint(style, s string) string {
+	if style == "" || s == "" {
+		return s
+	}
+	return "\033[" + style + "m" + s + "\033[0m"
+}
+
+// Hyperlink returns text as a link to url with OSC 8, terminals without
+// them show just the text. The prompt and hints may contain links, they
+// take up no room.
+func Hyperlink(url, text string) string {
+	return "\033]8;;" + url + "\033\\" + text + "\033]8;;\033\\"
+}
+
+// ColorMode is whether the Theme is used.
+type ColorMode int
+
+const (
+	// follow the environment: no colors with NO_COLOR set, CLICOLOR=0 or
+	// TERM=dumb, unless CLICOLOR_FORCE is set to something but 0.
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+// ActiveTheme returns Config.Theme, or an empty Theme if there's none or
+// colors are off, see ColorMode.
+func (c *Config) ActiveTheme() Theme {
+	if c.Theme == nil || !c.colorsEnabled() {
+		return Theme{}
+	}
+	return *c.Theme
+}
+
+func (c *Config) colorsEnabled() bool {
+	switch c.ColorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if f := os.Getenv("CLICOLOR_FORCE"); f != "" && f != "0" {
+		return true
+	}
+	return os.Getenv("CLICOLOR") != "0" && os.Getenv("TERM") != "dumb"
+}
+
+// Color is a color the terminal reported, e.g. by Terminal.Background.
+type Color struct {
+	R, G, B uint8
+}
+
+// Dark reports whether light text is more readable on c than dark text.
+func (c Color) Dark() bool {
+	// perceived brightness, ITU-R BT.601
+	return 299*int(c.R)+587*int(c.G)+114*int(c.B) < 128*1000
+}
+
+// parseColorReply parses the color of an OSC 10/11 answer, like
+// "rgb:ffff/ffff/dddd" with 1 to 4 hex digits per channel.
+func parseColorReply(s string) (Color, bool) {
+	if i := strings.IndexByte(s, ':'); i >= 0 && strings.HasPrefix(s, "rgb") {
+		s = s[i+1:]
+	} else {
+		return Color{}, false
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) < 3 {
+		return Color{}, false
+	}
+	var rgb [3]uint8
+	for i := range rgb {
+		p := parts[i]
+		v, err := strconv.ParseUint(p, 16, 16)
+		if err != nil || len(p) == 0 || len(p) > 4 {
+			return Color{}, false
+		}
+		max := uint64(1)<<(4*uint(len(p))) - 1
+		rgb[i] = uint8(v * 255 / max)
+	}
+	return Color{rgb[0], rgb[1], rgb[2]}, true
+}
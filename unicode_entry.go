@@ -0,0 +1,180 @@
+package rawterm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// digraphs are the two character sequences accepted by code point entry,
+// a subset of RFC 1345.
+var digraphs = map[string]rune{
+	"a!": 'à', "a'": 'á', "a>": 'â', "a?": 'ã', "a:": 'ä', "aa": 'å', "ae": 'æ',
+	"A!": 'À', "A'": 'Á', "A>": 'Â', "A?": 'Ã', "A:": 'Ä', "AA": 'Å', "AE": 'Æ',
+	"c,": 'ç', "C,": 'Ç',
+	"e!": 'è', "e'": 'é', "e>": 'ê', "e:": 'ë',
+	"E!": 'È', "E'": 'É', "E>": 'Ê', "E:": 'Ë',
+	"i!": 'ì', "i'": 'í', "i>": 'î', "i:": 'ï',
+	"I!": 'Ì', "I'": 'Í', "I>": 'Î', "I:": 'Ï',
+	"n?": 'ñ', "N?": 'Ñ',
+	"o!": 'ò', "o'": 'ó', "o>": 'ô', "o?": 'õ', "o:": 'ö', "o/": 'ø',
+	"O!": 'Ò', "O'": 'Ó', "O>": 'Ô', "O?": 'Õ', "O:": 'Ö', "O/": 'Ø',
+	"u!": 'ù', "u'": 'ú', "u>": 'û', "u:": 'ü',
+	"U!": 'Ù', "U'": 'Ú', "U>": 'Û', "U:": 'Ü',
+	"y'": 'ý', "y:": 'ÿ', "ss": 'ß',
+	"Eu": '€', "Pd": '£', "Ye": '¥', "Ct": '¢', "SE": '§',
+	"Co": '©', "Rg": '®', "DG": '°', "+-": '±', "My": 'µ',
+	"<<": '«', ">>": '»', "!I": '¡', "?I": '¿',
+	"a*": 'α', "b*": 'β', "g*": 'γ', "d*": 'δ', "p*": 'π', "l*": 'λ',
+}
+
+// unicodeEntry reads a character by its hex code point or a digraph after
+// Config.UnicodeEntryKey, by default Ctrl-X 8 unless Ctrl-X is bound to
+// something else. A code point is ended with
+// Enter or Space, a digraph is inserted as soon as it's complete, ESC or
+// Ctrl-G cancel.
+type unicodeEntry struct {
+	o      *Operation
+	prefix bool // Ctrl-X of the default chord was seen
+	active bool
+	input  []rune
+	prompt string // to restore when done
+}
+
+// handle returns true if ev was consumed.
+func (u *unicodeEntry) handle(ev KeyEvent) bool {
+	cfg := u.o.cfg
+	if cfg.DisableUnicodeEntry {
+		return false
+	}
+	switch {
+	case u.active:
+		u.key(ev)
+		return true
+	case u.prefix:
+		u.prefix = false
+		if ev == (KeyEvent{Rune: '8'}) {
+			u.start()
+			return true
+		}
+		return false // an unknown Ctrl-X chord, use the key as it is
+	case cfg.UnicodeEntryKey.Rune != 0:
+		if ev == cfg.UnicodeEntryKey {
+			u.start()
+			return true
+		}
+	case ev == (KeyEvent{Rune: CharCtrlX}) && !u.o.bound(ev):
+		u.prefix = true
+		return true
+	}
+	return false
+}
+
+func (u *unicodeEntry) start() {
+	u.prompt = u.o.buf.Prompt()
+	u.active = true
+	u.input = u.input[:0]
+	u.showPrompt()
+}
+
+func (u *unicodeEntry) key(ev KeyEvent) {
+	if ev.Mod != 0 {
+		u.o.t.Bell()
+		return
+	}
+	switch ev.Rune {
+	case CharEnter, CharCtrlJ, CharInterrupt:
+		// the terminal stops reading after these until the line is done
+		u.o.t.KickRead()
+	}
+	switch r := ev.Rune; {
+	case r == CharEnter || r == CharCtrlJ || r == ' ':
+		r, ok := u.codePoint()
+		u.stop()
+		if !ok {
+			u.o.t.Bell()
+			return
+		}
+		u.o.insert([]rune{r})
+	case r == CharEsc || r == CharBell || r == CharInterrupt:
+		u.stop()
+	case r == CharBackspace || r == CharCtrlH:
+		if len(u.input) > 0 {
+			u.input = u.input[:len(u.input)-1]
+		}
+		u.showPrompt()
+	case IsPrintable(r) && r < utf8.RuneSelf:
+		u.input = append(u.input, r)
+		if d, ok := digraphs[string(u.input)]; ok && len(u.input) == 2 && !u.isCodePoint() {
+			u.stop()
+			u.o.insert([]rune{d})
+			return
+		}
+		if len(u.input) > 1 && !u.isCodePoint() {
+			u.input = u.input[:len(u.input)-1]
+			u.o.t.Bell()
+		}
+		u.showPrompt()
+	default:
+		u.o.t.Bell()
+	}
+}
+
+// isCodePoint reports whether the input so far is a hex code point,
+// optionally prefixed with U or U+. Digraphs like "ae" take precedence.
+func (u *unicodeEntry) isCodePoint() bool {
+	if _, ok := digraphs[string(u.input)]; ok {
+		return false
+	}
+	s := trimCodePointPrefix(string(u.input))
+	if len(s) > 6 {
+		return false
+	}
+	_, err := strconv.ParseUint("0"+s, 16, 32)
+	return err == nil
+}
+
+func (u *unicodeEntry) codePoint() (rune, bool) {
+	n, err := strconv.ParseUint(trimCodePointPrefix(string(u.input)), 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) || !IsPrintable(rune(n)) {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+func trimCodePointPrefix(s string) string {
+	if len(s) > 0 && (s[0] == 'U' || s[0] == 'u') {
+		s = strings.TrimPrefix(s[1:], "+")
+	}
+	return s
+}
+
+func (u *unicodeEntry) showPrompt() {
+	u.o.mode.Store("char: " + string(u.input))
+	u.setPrompt(u.prompt + "(char: " + string(u.input) + ") ")
+}
+
+func (u *unicodeEntry) stop() {
+	u.active = false
+	u.input = u.input[:0]
+	u.o.mode.Store("")
+	u.setPrompt(u.prompt)
+}
+
+// reset leaves entry mode when the line is done.
+func (u *unicodeEntry) reset() {
+	u.prefix = false
+	if u.active {
+		u.stop()
+	}
+}
+
+// setPrompt shows p unless there's a prompt template, which shows the
+// entry with {mode}.
+func (u *unicodeEntry) setPrompt(p string) {
+	u.o.buf.Clean()
+	if u.o.cfg.PromptTemplate == "" {
+		u.o.buf.SetPrompt(p)
+	}
+	u.o.buf.Refresh(nil)
+}
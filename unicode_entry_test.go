@@ -0,0 +1,28 @@
+package rawterm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUnicodeEntry(t *testing.T) {
+	// a code point, a digraph, a cancelled entry and an unknown chord
+	in := bytes.NewBufferString("a\x188U+e9 \x188o/\x188z\x07b\x18c\r")
+	rl, _ := newTestInstance(t, in)
+
+	line, err := rl.Readline()
+	if err != nil || line != "aéøbc" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	// a bound Ctrl-X isn't taken as the start of the chord
+	cut := func(line []rune, pos int, key KeyEvent) ([]rune, int, bool) {
+		return nil, 0, true
+	}
+	rl, _ = newTestInstance(t, strings.NewReader("ab\x188\r"),
+		WithKeyBinding(KeyEvent{Rune: CharCtrlX}, cut))
+	if line, err := rl.Readline(); err != nil || line != "8" {
+		t.Fatal("result not expect", line, err)
+	}
+}
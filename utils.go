@@ -4,13 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"container/list"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 )
 
 var (
@@ -33,13 +33,16 @@ const (
 	CharEnter     = 13
 	CharNext      = 14
 	CharPrev      = 16
+	CharCtrlQ     = 17
 	CharBckSearch = 18
 	CharFwdSearch = 19
 	CharTranspose = 20
 	CharCtrlU     = 21
 	CharCtrlW     = 23
+	CharCtrlX     = 24
 	CharCtrlZ     = 26
 	CharEsc       = 27
+	CharQuit      = 28
 	CharEscapeEx  = 91
 	CharBackspace = 127
 )
@@ -52,6 +55,28 @@ const (
 	MetaTranspose
 )
 
+// keys without a character of their own, decoded from the escape sequences
+// of common terminals so they can be bound with Config.Bind.
+const (
+	KeyF1 rune = -iota - 32
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyInsert
+)
+
 // WaitForResume need to call before current process got suspend.
 // It will run a ticker until a long duration is occurs,
 // which means this process is resumed.
@@ -77,15 +102,13 @@ func WaitForResume() chan struct{} {
 	return ch
 }
 
+// Restore restores the terminal connected to the given file descriptor to a
+// state returned by MakeRaw or GetState.
 func Restore(fd int, state *State) error {
-	err := restoreTerm(fd, state)
-	if err != nil {
-		// errno 0 means everything is ok :)
-		if err.Error() == "errno 0" {
-			err = nil
-		}
+	if state == nil {
+		return errors.New("no terminal state to restore")
 	}
-	return nil
+	return restoreTerm(fd, state)
 }
 
 func IsPrintable(key rune) bool {
@@ -106,18 +129,56 @@ func escapeExKey(key *escapeKeyPair) rune {
 	case 'B':
 		r = CharNext
 	case 'H':
-		r = CharLineStart
+		r = KeyHome
 	case 'F':
-		r = CharLineEnd
+		r = KeyEnd
+	case 'P', 'Q', 'R', 'S': // xterm F1-F4 with modifiers, Esc[1;2P
+		r = KeyF1 - (key.typ - 'P')
 	case '~':
-		if key.attr == "3" {
-			r = CharDelete
+		sp := strings.SplitN(key.attr, ";", 2)
+		r = tildeKeys[sp[0]]
+	case '[':
+		if len(key.attr) == 1 && key.attr[0] >= 'A' && key.attr[0] <= 'E' {
+			r = KeyF1 - rune(key.attr[0]-'A')
 		}
 	default:
 	}
 	return r
 }
 
+// the keys sent as Esc[n~ by xterm, vt220, rxvt and the linux console
+var tildeKeys = map[string]rune{
+	"1":  KeyHome,
+	"2":  KeyInsert,
+	"3":  CharDelete,
+	"4":  KeyEnd,
+	"5":  KeyPageUp,
+	"6":  KeyPageDown,
+	"7":  KeyHome,
+	"8":  KeyEnd,
+	"11": KeyF1,
+	"12": KeyF2,
+	"13": KeyF3,
+	"14": KeyF4,
+	"15": KeyF5,
+	"17": KeyF6,
+	"18": KeyF7,
+	"19": KeyF8,
+	"20": KeyF9,
+	"21": KeyF10,
+	"23": KeyF11,
+	"24": KeyF12,
+}
+
+// keyModifier returns the modifiers of an Esc[1;modX or Esc[n;mod~ key.
+func keyModifier(key *escapeKeyPair) Modifier {
+	_, m, ok := key.Get2()
+	if !ok || m < 1 {
+		return 0
+	}
+	return Modifier(m-1) & (ModShift | ModAlt | ModCtrl)
+}
+
 type escapeKeyPair struct {
 	attr string
 	typ  rune
@@ -141,56 +202,74 @@ func (e *escapeKeyPair) Get2() (int, int, bool) {
 
 func readEscKey(r rune, reader *bufio.Reader) *escapeKeyPair {
 	p := escapeKeyPair{}
-	buf := bytes.NewBuffer(nil)
-	for {
-		if r == ';' {
-		} else if unicode.IsNumber(r) {
-		} else {
-			p.typ = r
+	if r == '[' { // linux console F1-F5, Esc[[A
+		p.typ = r
+		r, _, _ = reader.ReadRune()
+		p.attr = string(r)
+		return &p
+	}
+	seq := ansiParser{state: ansiCSIParam}
+	seq.csi = func(params, inter []rune, final rune) {
+		p.attr, p.typ = string(params), final
+		if len(inter) > 0 || (len(params) > 0 && params[0] >= '<') {
+			// private sequences like mouse reports aren't keys
+			p.typ = 0
+		}
+	}
+	for !seq.feed(r) {
+		var err error
+		if r, _, err = reader.ReadRune(); err != nil {
 			break
 		}
-		buf.WriteRune(r)
-		r, _, _ = reader.ReadRune()
 	}
-	p.attr = buf.String()
 	return &p
 }
 
-// translate EscX to Meta+X
-func escapeKey(r rune, reader *bufio.Reader) rune {
+// translate EscX to Alt+X
+func escapeKey(r rune, reader *bufio.Reader, osc func(data []rune)) KeyEvent {
 	switch r {
-	case 'b':
-		r = MetaBackward
-	case 'f':
-		r = MetaForward
-	case 'd':
-		r = MetaDelete
-	case CharTranspose:
-		r = MetaTranspose
-	case CharBackspace:
-		r = MetaBackspace
+	case CharEsc:
+		return KeyEvent{Rune: r}
 	case 'O':
 		d, _, _ := reader.ReadRune()
 		switch d {
 		case 'H':
-			r = CharLineStart
+			return KeyEvent{Rune: KeyHome}
 		case 'F':
-			r = CharLineEnd
+			return KeyEvent{Rune: KeyEnd}
+		case 'P', 'Q', 'R', 'S':
+			return KeyEvent{Rune: KeyF1 - (d - 'P')}
 		default:
 			reader.UnreadRune()
 		}
-	case CharEsc:
-
+	case ']', 'P':
+		// an OSC or DCS reply, e.g. to a color query. Only if it has
+		// arrived already, Alt+] and Alt+P are keys too.
+		if reader.Buffered() == 0 {
+			break
+		}
+		seq := ansiParser{state: ansiEscape, osc: osc}
+		seq.feed(r)
+		for {
+			c, _, err := reader.ReadRune()
+			if err != nil || seq.feed(c) {
+				return KeyEvent{}
+			}
+		}
 	}
-	return r
+	return KeyEvent{Rune: r, Mod: ModAlt}
 }
 
 func SplitByLine(start, screenWidth int, rs []rune) []string {
+	return splitByLine(start, screenWidth, rs, runes.Width)
+}
+
+func splitByLine(start, screenWidth int, rs []rune, width func(rune) int) []string {
 	var ret []string
 	buf := bytes.NewBuffer(nil)
 	currentWidth := start
 	for _, r := range rs {
-		w := runes.Width(r)
+		w := width(r)
 		currentWidth += w
 		buf.WriteRune(r)
 		if currentWidth >= screenWidth {
@@ -203,6 +282,16 @@ func SplitByLine(start, screenWidth int, rs []rune) []string {
 	return ret
 }
 
+// GetScreenHeight returns the number of rows of the terminal, -1 if it's
+// unknown.
+func GetScreenHeight() int {
+	_, h, err := GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return -1
+	}
+	return h
+}
+
 // calculate how many lines for N character
 func LineCount(screenWidth, w int) int {
 	r := w / screenWidth
@@ -234,20 +323,53 @@ func GetInt(s []string, def int) int {
 	return c
 }
 
+// RawMode is the default raw mode implementation of Config. The terminal
+// state is saved by the first Enter and every Exit restores that one, so a
+// stray nested Enter can't make a raw state become the one restored.
 type RawMode struct {
 	state *State
+	// used instead of stdin if set, see Config.UseTTY
+	tty *os.File
+	// passed to MakeRawWith, see Config.RawModeFlags and Config.FuncRawTermios
+	flags   RawModeFlags
+	termios func(*Termios)
+}
+
+// RawModeFlags selects what MakeRawWith leaves enabled of the terminal's own
+// input handling. Output processing (OPOST) is always kept, so "\n" still
+// returns the carriage.
+type RawModeFlags uint
+
+const (
+	// Ctrl-C and Ctrl-Z raise SIGINT and SIGTSTP instead of being read (ISIG)
+	RawKeepSignals RawModeFlags = 1 << iota
+	// Ctrl-S and Ctrl-Q stop and start the output instead of being read (IXON)
+	RawKeepFlowControl
+)
+
+func (r *RawMode) fd() int {
+	if r.tty != nil {
+		return int(r.tty.Fd())
+	}
+	return GetStdin()
 }
 
-func (r *RawMode) Enter() (err error) {
-	r.state, err = MakeRaw(GetStdin())
-	return err
+func (r *RawMode) Enter() error {
+	state, err := MakeRawWith(r.fd(), r.flags, r.termios)
+	if err != nil {
+		return err
+	}
+	if r.state == nil {
+		r.state = state
+	}
+	return nil
 }
 
 func (r *RawMode) Exit() error {
 	if r.state == nil {
 		return nil
 	}
-	return Restore(GetStdin(), r.state)
+	return Restore(r.fd(), r.state)
 }
 
 // -----------------------------------------------------------------------------
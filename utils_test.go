@@ -1 +1,42 @@
 package rawterm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTermUtilities(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	fd := int(r.Fd())
+	if IsTerminal(fd) {
+		t.Fatal("a pipe is no terminal")
+	}
+	if w, h, err := GetSize(fd); err == nil || w != -1 || h != -1 {
+		t.Fatal("size not expect", w, h, err)
+	}
+	if _, err := MakeRaw(fd); err == nil {
+		t.Fatal("made a pipe raw")
+	}
+	if err := Restore(fd, nil); err == nil {
+		t.Fatal("restored nothing")
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	defer func() { savedStates = nil }()
+	if err := RestoreState(); err == nil {
+		t.Fatal("restored without a saved state")
+	}
+	if err := SaveState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreState(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -28,6 +28,20 @@ func SuspendMe() {
 	p.Signal(syscall.SIGTSTP)
 }
 
+// keySignal returns the signal the terminal would send for r if it wasn't
+// in raw mode.
+func keySignal(r rune) os.Signal {
+	switch r {
+	case CharInterrupt:
+		return syscall.SIGINT
+	case CharCtrlZ:
+		return syscall.SIGTSTP
+	case CharQuit:
+		return syscall.SIGQUIT
+	}
+	return nil
+}
+
 // get width of the terminal
 func getWidth(stdoutFd int) int {
 	ws := &winsize{}
@@ -56,6 +70,25 @@ func ClearScreen(w io.Writer) (int, error) {
 	return w.Write([]byte("\033[H"))
 }
 
+// unix terminals understand ANSI themselves
+func newConsoleWriter(w io.Writer) io.Writer {
+	return w
+}
+
+// the terminal sends escape sequences itself, the streams are used as
+// they are
+func consoleInput(r io.Reader) io.Reader {
+	return r
+}
+
+func consoleOutput(w io.Writer) io.Writer {
+	return w
+}
+
+func ttyInput(tty *os.File) io.Reader {
+	return tty
+}
+
 func DefaultIsTerminal() bool {
 	return IsTerminal(syscall.Stdin) && (IsTerminal(syscall.Stdout) || IsTerminal(syscall.Stderr))
 }
@@ -64,6 +97,10 @@ func GetStdin() int {
 	return syscall.Stdin
 }
 
+func openTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
 // -----------------------------------------------------------------------------
 
 var (
@@ -4,22 +4,42 @@ package rawterm
 
 import (
 	"io"
+	"os"
+	"sync"
 	"syscall"
+	"time"
 )
 
 func SuspendMe() {
 }
 
+// keySignal returns the signal the console would send for r if it wasn't
+// in raw mode.
+func keySignal(r rune) os.Signal {
+	if r == CharInterrupt {
+		return os.Interrupt
+	}
+	return nil
+}
+
 func GetStdin() int {
 	return int(syscall.Stdin)
 }
 
+func openTTY() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
+
 func init() {
 	isWindows = true
 }
 
 // get width of the terminal
 func GetScreenWidth() int {
+	if isCygwin {
+		w, _, _ := sttyGetSize()
+		return w
+	}
 	info, _ := GetConsoleScreenBufferInfo()
 	if info == nil {
 		return -1
@@ -28,14 +48,73 @@ func GetScreenWidth() int {
 }
 
 // ClearScreen clears the console screen
-func ClearScreen(_ io.Writer) error {
+func ClearScreen(w io.Writer) error {
+	if isCygwin {
+		_, err := w.Write([]byte("\033[H"))
+		return err
+	}
 	return SetConsoleCursorPosition(&_COORD{0, 0})
 }
 
+// the translation of ANSIWriter is only needed on consoles without VT support
+func newConsoleWriter(w io.Writer) io.Writer {
+	if vtOutput || isCygwin {
+		return w
+	}
+	return NewANSIWriter(w)
+}
+
+func newStdinReader(r io.Reader) io.Reader {
+	return NewCancelableStdin(r)
+}
+
 func DefaultIsTerminal() bool {
 	return true
 }
 
-func DefaultOnWidthChanged(func()) {
+// -----------------------------------------------------------------------------
+
+// there is no SIGWINCH on windows, so the console size is polled instead.
+var widthPollInterval = 250 * time.Millisecond
+
+var (
+	widthChange sync.Once
+	// guards the callback and the width it was last called for, which the
+	// poll and RawReader share so a resize seen by both fires once
+	widthMu             sync.Mutex
+	widthChangeCallback func()
+	lastWidth           int
+)
 
+func DefaultOnWidthChanged(f func()) {
+	widthMu.Lock()
+	widthChangeCallback = f
+	lastWidth = GetScreenWidth()
+	widthMu.Unlock()
+	// spawning stty on every tick is too expensive for a pty
+	if isCygwin {
+		return
+	}
+	widthChange.Do(func() {
+		go func() {
+			for range time.Tick(widthPollInterval) {
+				notifyWidthChanged()
+			}
+		}()
+	})
+}
+
+// notifyWidthChanged calls the callback if the width changed since the last
+// call. RawReader calls it when the console reports a buffer size event, so
+// we don't have to wait for the next poll.
+func notifyWidthChanged() {
+	widthMu.Lock()
+	width := GetScreenWidth()
+	f := widthChangeCallback
+	changed := width != lastWidth
+	lastWidth = width
+	widthMu.Unlock()
+	if changed && f != nil {
+		f()
+	}
 }
@@ -22,6 +22,8 @@ type Kernel struct {
 	ReadConsoleInputW,
 	GetConsoleScreenBufferInfo,
 	GetConsoleCursorInfo,
+	SetConsoleCursorInfo,
+	GetNumberOfConsoleInputEvents,
 	GetStdHandle CallFunc
 }
 
@@ -147,6 +149,15 @@ func GetConsoleCursorInfo() (*_CONSOLE_CURSOR_INFO, error) {
 	return t, err
 }
 
+func SetConsoleCursorVisible(visible bool) error {
+	t, err := GetConsoleCursorInfo()
+	if err != nil {
+		return err
+	}
+	t.bVisible = visible
+	return kernel.SetConsoleCursorInfo(stdout, uintptr(unsafe.Pointer(t)))
+}
+
 func SetConsoleCursorPosition(c *_COORD) error {
 	return kernel.SetConsoleCursorPosition(stdout, c.ptr())
 }